@@ -0,0 +1,224 @@
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+// The list of actions that can be bound to keys or run from the command palette.
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"fyne.io/fyne/v2"
+)
+
+// actions is the list of all the commands, in the order they are displayed.
+var actions []*action
+
+// The actions are initialised here to avoid an initialisation loop, since
+// some actions refer to the list.
+func init() {
+	actions = []*action{
+		{"next", "Next image", []fyne.KeyName{"N", fyne.KeyRight, fyne.KeySpace}, func(a *Ptag) { a.move(1) }},
+		{"prev", "Previous image", []fyne.KeyName{"P", fyne.KeyLeft, fyne.KeyBackspace}, func(a *Ptag) { a.move(-1) }},
+		{"first", "First image", []fyne.KeyName{fyne.KeyHome}, func(a *Ptag) { a.setIndex(0) }},
+		{"last", "Last image", []fyne.KeyName{fyne.KeyEnd}, func(a *Ptag) { a.setIndex(len(a.picts) - 1) }},
+		{"forward", "Jump forward 10 images", []fyne.KeyName{fyne.KeyDown, fyne.KeyPageDown}, func(a *Ptag) { a.move(10) }},
+		{"back", "Jump back 10 images", []fyne.KeyName{fyne.KeyUp, fyne.KeyPageUp}, func(a *Ptag) { a.move(-10) }},
+		{"rate-none", "Delete the rating", []fyne.KeyName{fyne.KeyMinus}, func(a *Ptag) { a.rate(-1) }},
+		{"rate-0", "Set the rating to 0", []fyne.KeyName{fyne.Key0}, func(a *Ptag) { a.rate(0) }},
+		{"rate-1", "Set the rating to 1", []fyne.KeyName{fyne.Key1}, func(a *Ptag) { a.rate(1) }},
+		{"rate-2", "Set the rating to 2", []fyne.KeyName{fyne.Key2}, func(a *Ptag) { a.rate(2) }},
+		{"rate-3", "Set the rating to 3", []fyne.KeyName{fyne.Key3}, func(a *Ptag) { a.rate(3) }},
+		{"rate-4", "Set the rating to 4", []fyne.KeyName{fyne.Key4}, func(a *Ptag) { a.rate(4) }},
+		{"rate-5", "Set the rating to 5", []fyne.KeyName{fyne.Key5}, func(a *Ptag) { a.rate(5) }},
+		{"label-red", "Set the label to Red", []fyne.KeyName{fyne.Key6}, func(a *Ptag) { a.setLabel("Red") }},
+		{"label-yellow", "Set the label to Yellow", []fyne.KeyName{fyne.Key7}, func(a *Ptag) { a.setLabel("Yellow") }},
+		{"label-green", "Set the label to Green", []fyne.KeyName{fyne.Key8}, func(a *Ptag) { a.setLabel("Green") }},
+		{"label-blue", "Set the label to Blue", []fyne.KeyName{fyne.Key9}, func(a *Ptag) { a.setLabel("Blue") }},
+		{"label-purple", "Set the label to Purple", nil, func(a *Ptag) { a.setLabel("Purple") }},
+		{"label-none", "Delete the label", nil, func(a *Ptag) { a.setLabel("") }},
+		{"mark", "Mark or unmark the image", []fyne.KeyName{"T"}, func(a *Ptag) { a.toggleMark() }},
+		{"mark-range", "Mark the images from the last marked image", []fyne.KeyName{"O"}, func(a *Ptag) { a.markRange() }},
+		{"mark-all", "Mark all the images", nil, func(a *Ptag) { a.markAll() }},
+		{"mark-clear", "Unmark all the images", nil, func(a *Ptag) { a.clearMarks() }},
+		{"batch-rate-none", "Marked: delete the rating", nil, func(a *Ptag) { a.batchRate(-1) }},
+		{"batch-rate-0", "Marked: set the rating to 0", nil, func(a *Ptag) { a.batchRate(0) }},
+		{"batch-rate-1", "Marked: set the rating to 1", nil, func(a *Ptag) { a.batchRate(1) }},
+		{"batch-rate-2", "Marked: set the rating to 2", nil, func(a *Ptag) { a.batchRate(2) }},
+		{"batch-rate-3", "Marked: set the rating to 3", nil, func(a *Ptag) { a.batchRate(3) }},
+		{"batch-rate-4", "Marked: set the rating to 4", nil, func(a *Ptag) { a.batchRate(4) }},
+		{"batch-rate-5", "Marked: set the rating to 5", nil, func(a *Ptag) { a.batchRate(5) }},
+		{"batch-rotate", "Marked: rotate right 90 degrees", nil, func(a *Ptag) { a.batchOrientation("Rotate", rotateRight) }},
+		{"batch-mirror", "Marked: mirror flip", nil, func(a *Ptag) { a.batchOrientation("Mirror", mirrorFlip) }},
+		{"batch-caption", "Marked: set the caption", nil, func(a *Ptag) { a.batchCaption() }},
+		{"batch-caption-apply", "Marked: apply the caption of this image", nil, func(a *Ptag) { a.batchApplyCaption() }},
+		{"batch-label-red", "Marked: set the label to Red", nil, func(a *Ptag) { a.batchLabel("Red") }},
+		{"batch-label-yellow", "Marked: set the label to Yellow", nil, func(a *Ptag) { a.batchLabel("Yellow") }},
+		{"batch-label-green", "Marked: set the label to Green", nil, func(a *Ptag) { a.batchLabel("Green") }},
+		{"batch-label-blue", "Marked: set the label to Blue", nil, func(a *Ptag) { a.batchLabel("Blue") }},
+		{"batch-label-purple", "Marked: set the label to Purple", nil, func(a *Ptag) { a.batchLabel("Purple") }},
+		{"batch-label-none", "Marked: delete the label", nil, func(a *Ptag) { a.batchLabel("") }},
+		{"caption-edit", "Edit the caption (Enter to save, Esc to cancel)", []fyne.KeyName{fyne.KeyReturn, fyne.KeyEnter}, func(a *Ptag) { a.editCaption() }},
+		{"describe", "Edit the title, headline and description", []fyne.KeyName{"E"}, func(a *Ptag) { a.editDescription() }},
+		{"keywords", "Select the keywords", []fyne.KeyName{"W"}, func(a *Ptag) { a.pickKeywords() }},
+		{"geotag", "Marked: set the GPS position from a GPX track", nil, func(a *Ptag) { a.geotag() }},
+		{"location", "Set the city, state and country from the GPS position", []fyne.KeyName{"A"}, func(a *Ptag) { a.fillLocation() }},
+		{"batch-location", "Marked: set the city, state and country from the GPS position", nil, func(a *Ptag) { a.batchLocation() }},
+		{"shift-time", "Marked: shift the capture time", nil, func(a *Ptag) { a.shiftTime() }},
+		{"duplicates", "Find duplicate images and review them", nil, func(a *Ptag) { a.findDuplicates() }},
+		{"dup-keep", "Duplicates: keep the selected image and reject the others shown", []fyne.KeyName{"Z"}, func(a *Ptag) { a.keepDuplicate(a.reject) }},
+		{"dup-keep-trash", "Duplicates: keep the selected image and trash the others shown", nil, func(a *Ptag) { a.keepDuplicate(a.trash) }},
+		{"dup-next", "Duplicates: skip to the next group", []fyne.KeyName{"J"}, func(a *Ptag) { a.nextGroup() }},
+		{"dup-stop", "Duplicates: stop reviewing", nil, func(a *Ptag) { a.stopReview() }},
+		{"stacks", "Toggle stacking images taken within the stack gap", []fyne.KeyName{fyne.KeyBackslash}, func(a *Ptag) { a.toggleStacks() }},
+		{"stack-expand", "Expand or collapse the current stack", []fyne.KeyName{fyne.KeyEqual}, func(a *Ptag) { a.expandStack() }},
+		{"export", "Export the marked images as resized JPEGs", nil, func(a *Ptag) { a.export() }},
+		{"gallery", "Build an HTML gallery of the displayed images", nil, func(a *Ptag) { a.gallery() }},
+		{"contact-sheet", "Write a contact sheet of the marked (or displayed) images", nil, func(a *Ptag) { a.contactSheet() }},
+		{"language", "Change the caption language", []fyne.KeyName{"L"}, func(a *Ptag) { a.nextLanguage() }},
+		{"caption-previous", "Copy the caption from the previous image", []fyne.KeyName{"D"}, func(a *Ptag) { a.previousCaption() }},
+		{"caption-copy", "Copy the caption to the clipboard", nil, func(a *Ptag) { a.copyCaption() }},
+		{"caption-paste", "Set the caption from the clipboard", nil, func(a *Ptag) { a.pasteCaption() }},
+		{"fullscreen", "Toggle full-screen", []fyne.KeyName{"F"}, func(a *Ptag) { a.fullScreen() }},
+		{"rotate", "Rotate right 90 degrees", []fyne.KeyName{"R"}, func(a *Ptag) { a.rotate() }},
+		{"mirror", "Mirror flip the image", []fyne.KeyName{"M"}, func(a *Ptag) { a.mirror() }},
+		{"reject", "Move the image to the reject directory", []fyne.KeyName{"X"}, func(a *Ptag) { a.reject() }},
+		{"trash", "Move the image to the trash", []fyne.KeyName{fyne.KeyDelete}, func(a *Ptag) { a.trash() }},
+		{"pick", "Copy the image to the picks directory", []fyne.KeyName{"Y"}, func(a *Ptag) { a.pick() }},
+		{"undo", "Undo the last move, copy, trash or time shift", []fyne.KeyName{"U"}, func(a *Ptag) { a.undo() }},
+		{"info", "Show or hide the shooting information", []fyne.KeyName{"I"}, func(a *Ptag) { a.toggleInfo() }},
+		{"histogram", "Show or hide the histogram", []fyne.KeyName{"G"}, func(a *Ptag) { a.toggleHistogram() }},
+		{"clipping", "Start or stop blinking the clipped highlights and shadows", []fyne.KeyName{"B"}, func(a *Ptag) { a.toggleClipping() }},
+		{"slideshow", "Start or stop the slideshow", []fyne.KeyName{"S"}, func(a *Ptag) { a.toggleSlideshow() }},
+		{"slideshow-pause", "Pause or resume the slideshow", []fyne.KeyName{fyne.KeyPeriod}, func(a *Ptag) { a.pauseSlideshow() }},
+		{"slideshow-slower", "Increase the slideshow delay", []fyne.KeyName{fyne.KeyRightBracket}, func(a *Ptag) { a.adjustDelay(time.Second) }},
+		{"slideshow-faster", "Decrease the slideshow delay", []fyne.KeyName{fyne.KeyLeftBracket}, func(a *Ptag) { a.adjustDelay(-time.Second) }},
+		{"slideshow-loop", "Slideshow: toggle looping", nil, func(a *Ptag) { a.toggleLoop() }},
+		{"slideshow-shuffle", "Slideshow: toggle shuffle", nil, func(a *Ptag) { a.toggleShuffle() }},
+		{"slideshow-caption", "Slideshow: show or hide the caption", []fyne.KeyName{"C"}, func(a *Ptag) { a.toggleSlideCaption() }},
+		{"compare", "Cycle compare mode (off, 2 or 4 images)", []fyne.KeyName{"V"}, func(a *Ptag) { a.cycleCompare() }},
+		{"compare-select", "Compare: select the next panel", []fyne.KeyName{fyne.KeyTab}, func(a *Ptag) { a.selectPanel() }},
+		{"compare-promote", "Compare: promote the selected image to be the pick", []fyne.KeyName{"K"}, func(a *Ptag) { a.promote() }},
+		{"filter-1", "Filter: rating of 1 or more", nil, func(a *Ptag) { a.setFilter(ratingFilter(1)) }},
+		{"filter-2", "Filter: rating of 2 or more", nil, func(a *Ptag) { a.setFilter(ratingFilter(2)) }},
+		{"filter-3", "Filter: rating of 3 or more", nil, func(a *Ptag) { a.setFilter(ratingFilter(3)) }},
+		{"filter-4", "Filter: rating of 4 or more", nil, func(a *Ptag) { a.setFilter(ratingFilter(4)) }},
+		{"filter-5", "Filter: rating of 5", nil, func(a *Ptag) { a.setFilter(ratingFilter(5)) }},
+		{"filter-unrated", "Filter: unrated images", nil, func(a *Ptag) { a.setFilter(unratedFilter()) }},
+		{"filter-none", "Filter: show all images", nil, func(a *Ptag) { a.setFilter(nil) }},
+		{"help", "Show or hide the help", []fyne.KeyName{"H"}, func(a *Ptag) { a.toggleHelp() }},
+		{"palette", "Command palette", []fyne.KeyName{fyne.KeySlash}, func(a *Ptag) { a.showPalette() }},
+		{"quit", "Quit", []fyne.KeyName{"Q"}, func(a *Ptag) { a.quit() }},
+	}
+}
+
+// findAction returns the action with this id, or nil if not found.
+func findAction(id string) *action {
+	for _, act := range actions {
+		if act.id == id {
+			return act
+		}
+	}
+	return nil
+}
+
+// readKeymap reads a file of key bindings. Each line is of the form:
+// <action-id> <key> [<key> ...]
+// and replaces the default keys for that action. An action id with no keys
+// will remove the key bindings for that action.
+// Blank lines and lines starting with '#' are ignored.
+func readKeymap(file string) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	line := 0
+	for scanner.Scan() {
+		line++
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		act := findAction(fields[0])
+		if act == nil {
+			return fmt.Errorf("%s:%d: unknown action (%s)", file, line, fields[0])
+		}
+		act.keys = nil
+		for _, k := range fields[1:] {
+			act.keys = append(act.keys, fyne.KeyName(k))
+		}
+	}
+	return scanner.Err()
+}
+
+// keyMap creates the map of keys to actions.
+func keyMap() map[fyne.KeyName]*action {
+	m := make(map[fyne.KeyName]*action)
+	for _, act := range actions {
+		for _, k := range act.keys {
+			if prev, ok := m[k]; ok {
+				fmt.Fprintf(os.Stderr, "Key %s used by both %s and %s (ignored)\n", k, prev.id, act.id)
+				continue
+			}
+			m[k] = act
+		}
+	}
+	return m
+}
+
+// keyLabel returns a readable form of the action's keys.
+func (act *action) keyLabel() string {
+	var s []string
+	for _, k := range act.keys {
+		if len(k) == 1 {
+			s = append(s, fmt.Sprintf("'%s'", k))
+		} else {
+			s = append(s, fmt.Sprintf("<%s>", k))
+		}
+	}
+	return strings.Join(s, " ")
+}
+
+// keyHelp returns the list of shortcut keys as text.
+func keyHelp() string {
+	var b strings.Builder
+	for _, act := range actions {
+		if len(act.keys) != 0 {
+			fmt.Fprintf(&b, "  %-32s %s\n", act.keyLabel(), act.name)
+		}
+	}
+	return b.String()
+}
+
+// keyDown runs the action bound to this key.
+func (a *Ptag) keyDown(key *fyne.KeyEvent) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	if *verbose {
+		fmt.Printf("Key: %s\n", key.Name)
+	}
+	a.lastKey = key.Name
+	// Any key will dismiss the help.
+	if a.help != nil && a.help.Visible() {
+		a.help.Hide()
+		return
+	}
+	if act, ok := a.keys[key.Name]; ok {
+		act.run(a)
+	}
+}
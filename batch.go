@@ -0,0 +1,249 @@
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+// Marking images, and applying changes to all the marked images
+// as a background batch operation.
+
+import (
+	"fmt"
+	"image/color"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"fyne.io/fyne/v2/canvas"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+)
+
+// Maximum number of failures listed in the batch summary.
+const maxFailures = 10
+
+// newProgress creates the (initially hidden) progress overlay.
+func newProgress() *Progress {
+	p := &Progress{label: canvas.NewText("", color.White), bar: widget.NewProgressBar()}
+	bg := canvas.NewRectangle(color.NRGBA{0, 0, 0, 160})
+	p.box = container.NewStack(bg, container.NewPadded(container.NewBorder(nil, nil, p.label, nil, p.bar)))
+	p.box.Hide()
+	return p
+}
+
+// toggleMark marks or unmarks the current image.
+func (a *Ptag) toggleMark() {
+	p := a.picts[a.index]
+	p.marked = !p.marked
+	a.anchor = p
+	a.displayMarks()
+}
+
+// markRange marks the images between the last marked image and the current image.
+func (a *Ptag) markRange() {
+	start := -1
+	for i, p := range a.picts {
+		if p == a.anchor {
+			start = i
+		}
+	}
+	if start < 0 {
+		a.toggleMark()
+		return
+	}
+	end := a.index
+	if end < start {
+		start, end = end, start
+	}
+	for _, p := range a.picts[start : end+1] {
+		p.marked = true
+	}
+	a.anchor = a.picts[a.index]
+	a.displayMarks()
+}
+
+// markAll marks all the displayed images.
+func (a *Ptag) markAll() {
+	for _, p := range a.picts {
+		p.marked = true
+	}
+	a.displayMarks()
+}
+
+// clearMarks unmarks all the images.
+func (a *Ptag) clearMarks() {
+	for _, p := range a.all {
+		p.marked = false
+	}
+	a.anchor = nil
+	a.displayMarks()
+}
+
+// marked returns the list of marked images.
+func (a *Ptag) marked() []*Pict {
+	var m []*Pict
+	for _, p := range a.all {
+		if p.marked {
+			m = append(m, p)
+		}
+	}
+	return m
+}
+
+// displayMarks shows whether the current image is marked, and the number of marked images.
+func (a *Ptag) displayMarks() {
+	n := len(a.marked())
+	switch {
+	case n == 0:
+		a.marks.Text = ""
+	case a.picts[a.index].marked:
+		a.marks.Text = fmt.Sprintf("[Marked] %d", n)
+	default:
+		a.marks.Text = fmt.Sprintf("%d marked", n)
+	}
+	a.marks.Refresh()
+}
+
+// batch applies the operation to all the marked images in the background.
+// If reload is set, the images are reloaded afterwards e.g because the orientation changed.
+func (a *Ptag) batch(name string, reload bool, op func(*Pict) error) {
+	m := a.marked()
+	if len(m) == 0 {
+		a.setStatus("No images marked")
+		return
+	}
+	a.runBatch(name, m, reload, op, nil)
+}
+
+// runBatch applies the operation to the images in the background,
+// returning false if another batch operation is running.
+// If done is not nil, it is called when the operation has completed.
+// runBatch is called with the lock held. Only the operation is run in
+// the background, and the display is updated and done is called
+// with the lock held.
+func (a *Ptag) runBatch(name string, m []*Pict, reload bool, op func(*Pict) error, done func()) bool {
+	pr := a.progress
+	if pr.running {
+		a.setStatus("Batch operation already running")
+		return false
+	}
+	a.Sync()
+	pr.running = true
+	pr.label.Text = fmt.Sprintf("%s (%d images)", name, len(m))
+	pr.bar.SetValue(0)
+	pr.box.Show()
+	pr.label.Refresh()
+	go func() {
+		var count int32
+		var lock sync.Mutex
+		var failed []string
+		a.forAll(m, func(p *Pict) {
+			if err := op(p); err != nil {
+				lock.Lock()
+				failed = append(failed, fmt.Sprintf("%s: %v", p.Name(), err))
+				lock.Unlock()
+			}
+			pr.bar.SetValue(float64(atomic.AddInt32(&count, 1)) / float64(len(m)))
+		})
+		a.locked(func() {
+			pr.box.Hide()
+			pr.running = false
+			if reload {
+				a.flushCache()
+				a.redisplay()
+			} else {
+				a.show()
+			}
+			a.batchSummary(name, len(m), failed)
+			if done != nil {
+				done()
+			}
+		})
+	}()
+	return true
+}
+
+// batchSummary reports the result of a batch operation.
+func (a *Ptag) batchSummary(name string, total int, failed []string) {
+	if len(failed) == 0 {
+		a.setStatus(fmt.Sprintf("%s: %d images updated", name, total))
+		return
+	}
+	msg := fmt.Sprintf("%d of %d images failed:\n", len(failed), total)
+	if len(failed) > maxFailures {
+		msg += strings.Join(failed[:maxFailures], "\n") + "\n..."
+	} else {
+		msg += strings.Join(failed, "\n")
+	}
+	dialog.ShowInformation(name, msg, a.win)
+}
+
+// batchRate sets the rating on the marked images.
+func (a *Ptag) batchRate(rating int) {
+	name := fmt.Sprintf("Set rating to %d", rating)
+	if rating < 0 {
+		name = "Delete rating"
+	}
+	m := a.marked()
+	if len(m) == 0 {
+		a.setStatus("No images marked")
+		return
+	}
+	a.runBatch(name, m, false, func(p *Pict) error {
+		return p.SetRating(rating)
+	}, a.restack)
+}
+
+// batchOrientation rotates or flips the marked images.
+func (a *Ptag) batchOrientation(name string, adj map[string]string) {
+	a.batch(name, true, func(p *Pict) error {
+		_, _, err := p.AdjustOrientation(adj)
+		return err
+	})
+}
+
+// batchLabel sets the label on the marked images.
+func (a *Ptag) batchLabel(label string) {
+	name := fmt.Sprintf("Set label to %s", label)
+	if len(label) == 0 {
+		name = "Delete label"
+	}
+	a.batch(name, false, func(p *Pict) error {
+		return p.SetLabel(label)
+	})
+}
+
+// batchCaption asks for a caption, and sets it on the marked images.
+// The caption may contain template variables.
+func (a *Ptag) batchCaption() {
+	entry := widget.NewEntry()
+	entry.SetPlaceHolder("e.g {date} {camera}")
+	dialog.ShowForm("Caption for marked images", "Set", "Cancel",
+		[]*widget.FormItem{widget.NewFormItem("Caption", entry)},
+		func(ok bool) {
+			a.lock.Lock()
+			defer a.lock.Unlock()
+			if ok {
+				a.batchTemplate("Set caption", entry.Text)
+			}
+		}, a.win)
+}
+
+// setLabel sets the colour label on the current image.
+func (a *Ptag) setLabel(label string) {
+	p := a.picts[a.index]
+	if err := p.SetLabel(label); err != nil {
+		a.setStatus(fmt.Sprintf("Failed to set label: %v", err))
+	} else {
+		a.displayRating()
+	}
+}
@@ -12,43 +12,140 @@
 
 package main
 
-// Extend the Entry widget to capture mouse events
-// so that the caption window can be automatically focused.
+// Extend the Entry widget to handle editing the caption.
+// The caption is edited by selecting it with the keyboard or mouse.
+// Enter or moving the focus elsewhere commits the edit, Esc cancels it.
+// Optionally the caption can be automatically focused when the mouse
+// is over it, and written when the mouse leaves.
 
 import (
 	"fmt"
+
+	"fyne.io/fyne/v2"
 	"fyne.io/fyne/v2/driver/desktop"
 )
 
 func (c *CaptionEntry) MouseIn(*desktop.MouseEvent) {
-	c.app.win.Canvas().Focus(c)
+	c.app.lock.Lock()
+	defer c.app.lock.Unlock()
 	c.mouseIn = true
 	if *verbose {
 		fmt.Printf("MouseIn\n")
 	}
-	c.app.Updated() // Flag that the caption may have changed
+	if *hover {
+		c.app.win.Canvas().Focus(c)
+		c.app.Updated() // Flag that the caption may have changed
+	}
 }
 
 func (c *CaptionEntry) MouseOut() {
+	c.app.lock.Lock()
+	defer c.app.lock.Unlock()
 	if *verbose {
 		fmt.Printf("MouseOut\n")
 	}
 	c.mouseIn = false
+	// The edit continues while completions are displayed.
+	if !*hover || c.app.completer.box.Visible() {
+		return
+	}
 	c.app.win.Canvas().Unfocus()
-	c.app.Sync() // Write the caption to the EXIF data
 }
 
 func (c *CaptionEntry) MouseMoved(*desktop.MouseEvent) {
 }
 
+func (c *CaptionEntry) FocusGained() {
+	c.editing = true
+	c.Entry.FocusGained()
+}
+
+func (c *CaptionEntry) FocusLost() {
+	c.editing = false
+	c.app.completer.box.Hide()
+	c.Entry.FocusLost()
+	c.app.Sync() // Write the caption to the EXIF data
+}
+
+// TypedKey handles the keys that select a suggestion, and that finish the edit.
+func (c *CaptionEntry) TypedKey(key *fyne.KeyEvent) {
+	c.app.lock.Lock()
+	defer c.app.lock.Unlock()
+	if c.app.completer.box.Visible() {
+		switch key.Name {
+		case fyne.KeyDown:
+			c.app.moveSuggestion(1)
+			return
+		case fyne.KeyUp:
+			c.app.moveSuggestion(-1)
+			return
+		case fyne.KeyReturn, fyne.KeyEnter:
+			c.app.acceptSuggestion(c.app.completer.selected)
+			return
+		case fyne.KeyEscape:
+			c.app.closeSuggestions()
+			return
+		}
+	}
+	switch key.Name {
+	case fyne.KeyReturn, fyne.KeyEnter:
+		c.app.endEdit(true)
+	case fyne.KeyEscape:
+		c.app.endEdit(false)
+	default:
+		c.Entry.TypedKey(key)
+	}
+}
+
+// TypedRune holds the lock while the caption is changed.
+func (c *CaptionEntry) TypedRune(r rune) {
+	c.app.locked(func() { c.Entry.TypedRune(r) })
+}
+
+// TypedShortcut holds the lock while the caption is changed e.g by a paste.
+func (c *CaptionEntry) TypedShortcut(s fyne.Shortcut) {
+	c.app.locked(func() { c.Entry.TypedShortcut(s) })
+}
+
 func (c *CaptionEntry) OnChange(v string) {
 	if *verbose {
 		fmt.Printf("OnChange: <%s>\n", v)
 	}
 	c.app.Updated()
-	if !c.mouseIn {
-		// Change may have been due to a paste.
-		c.app.win.Canvas().Unfocus()
+	if c.editing {
+		c.app.suggest(v)
+	} else {
+		// Caption has been set e.g from a paste or a new image being shown.
 		c.app.Sync()
 	}
+	c.app.showDirty()
+}
+
+// editCaption starts editing the caption.
+func (a *Ptag) editCaption() {
+	a.win.Canvas().Focus(a.caption)
+}
+
+// endEdit finishes editing the caption, either writing the caption
+// or restoring the saved caption.
+func (a *Ptag) endEdit(commit bool) {
+	if !commit {
+		a.completer.quiet = true
+		c, _ := a.picts[a.index].Field(a.captionField())
+		a.caption.SetText(c)
+		a.completer.quiet = false
+	}
+	// Losing the focus writes the caption.
+	a.win.Canvas().Unfocus()
+}
+
+// showDirty displays whether the caption has been changed but not yet written.
+func (a *Ptag) showDirty() {
+	c, err := a.picts[a.index].Field(a.captionField())
+	if err == nil && c != a.caption.Text {
+		a.dirty.Text = "Unsaved"
+	} else {
+		a.dirty.Text = ""
+	}
+	a.dirty.Refresh()
 }
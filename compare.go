@@ -0,0 +1,250 @@
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+// Compare mode displays 2 or 4 images side by side.
+// The first panel holds the current pick, and the other panels hold
+// candidates that are compared against it. A candidate can be promoted to
+// be the pick, and the candidates stepped through the following images.
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"os"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/canvas"
+	"fyne.io/fyne/v2/container"
+)
+
+// Width of the border around the active panel.
+const activeBorder = 3
+
+// cycleCompare switches between single image, 2 image and 4 image display.
+func (a *Ptag) cycleCompare() {
+	switch {
+	case a.compare == nil:
+		a.startCompare(2)
+	case a.compare.n == 2:
+		a.startCompare(4)
+	default:
+		a.stopCompare()
+		a.flushCache()
+		a.setIndex(a.index)
+	}
+}
+
+// startCompare enters compare mode with n panels, using the current
+// image as the pick.
+func (a *Ptag) startCompare(n int) {
+	if len(a.picts) < 2 {
+		return
+	}
+	pick := a.index
+	if a.compare != nil {
+		pick = a.compare.panels[0]
+		a.stopCompare()
+	}
+	if n > len(a.picts) {
+		n = len(a.picts)
+	}
+	c := &Compare{n: n, panels: make([]int, n)}
+	cols := (n + 1) / 2
+	var cells []fyne.CanvasObject
+	for i := 0; i < n; i++ {
+		t := canvas.NewText("", color.White)
+		c.labels = append(c.labels, t)
+		bg := canvas.NewRectangle(color.NRGBA{0, 0, 0, 160})
+		cells = append(cells, container.NewVBox(container.NewHBox(container.NewStack(bg, t))))
+	}
+	c.grid = container.NewGridWithColumns(cols, cells...)
+	c.panels[0] = pick
+	a.compare = c
+	a.fillCandidates(pick + 1)
+	a.overlay.Add(c.grid)
+	a.flushCache()
+	a.setIndex(pick)
+}
+
+// stopCompare leaves compare mode, keeping the pick as the current image.
+func (a *Ptag) stopCompare() {
+	if a.compare == nil {
+		return
+	}
+	a.Sync()
+	a.index = a.compare.panels[0]
+	a.overlay.Remove(a.compare.grid)
+	a.compare = nil
+}
+
+// fillCandidates sets the candidate panels to the images starting at start,
+// skipping the pick. If there are not enough images, the start is moved back.
+func (a *Ptag) fillCandidates(start int) {
+	c := a.compare
+	pick := c.panels[0]
+	if start > len(a.picts)-(c.n-1) {
+		start = len(a.picts) - (c.n - 1)
+		if start <= pick {
+			// Leave room for the pick.
+			start--
+		}
+	}
+	if start < 0 {
+		start = 0
+	}
+	for i := 1; i < c.n; i++ {
+		if start == pick {
+			start++
+		}
+		c.panels[i] = start
+		start++
+	}
+}
+
+// lastPanel returns the highest image index being displayed.
+func (c *Compare) lastPanel() int {
+	last := 0
+	for _, p := range c.panels {
+		if p > last {
+			last = p
+		}
+	}
+	return last
+}
+
+// promote makes the active panel the pick, and steps the candidates
+// to the images following those displayed.
+func (a *Ptag) promote() {
+	c := a.compare
+	if c == nil {
+		return
+	}
+	a.Sync()
+	next := c.lastPanel() + 1
+	c.panels[0] = c.panels[c.active]
+	a.fillCandidates(next)
+	a.setIndex(c.panels[0])
+}
+
+// compareStep moves the candidates forward or back by a page of images.
+func (a *Ptag) compareStep(dir int) {
+	c := a.compare
+	a.Sync()
+	if dir > 0 {
+		a.fillCandidates(c.lastPanel() + 1)
+	} else {
+		first := len(a.picts)
+		for _, p := range c.panels[1:] {
+			if p < first {
+				first = p
+			}
+		}
+		a.fillCandidates(first - (c.n - 1))
+	}
+	a.setIndex(c.panels[c.active])
+}
+
+// selectPanel makes the next panel the active panel.
+func (a *Ptag) selectPanel() {
+	if c := a.compare; c != nil {
+		a.setIndex(c.panels[(c.active+1)%c.n])
+	}
+}
+
+// setPanel makes the panel holding this image the active panel.
+// If the image is not displayed, the candidates are replaced
+// starting with this image.
+func (a *Ptag) setPanel(index int) {
+	c := a.compare
+	for i, p := range c.panels {
+		if p == index {
+			c.active = i
+			return
+		}
+	}
+	a.fillCandidates(index)
+	c.active = 1
+	for i, p := range c.panels {
+		if p == index {
+			c.active = i
+		}
+	}
+}
+
+// panelRects returns the areas of the canvas used for each panel.
+func (c *Compare) panelRects(b image.Rectangle) []image.Rectangle {
+	cols := (c.n + 1) / 2
+	rows := (c.n + cols - 1) / cols
+	w := b.Dx() / cols
+	h := b.Dy() / rows
+	var r []image.Rectangle
+	for i := 0; i < c.n; i++ {
+		x := b.Min.X + (i%cols)*w
+		y := b.Min.Y + (i/cols)*h
+		r = append(r, image.Rect(x, y, x+w, y+h))
+	}
+	return r
+}
+
+// showCompare draws each of the panels.
+func (a *Ptag) showCompare() {
+	c := a.compare
+	rgba := a.iDraw.(*image.RGBA)
+	draw.Draw(rgba, rgba.Bounds(), image.NewUniform(color.Black), image.Point{}, draw.Src)
+	rects := c.panelRects(rgba.Bounds())
+	for i, index := range c.panels {
+		a.addCache(index)
+		p := a.picts[index]
+		if err := p.Draw(rgba.SubImage(rects[i]).(draw.Image)); err != nil {
+			fmt.Fprintf(os.Stderr, "%s: draw: %v\n", p.Name(), err)
+		}
+	}
+	// Outline the active panel.
+	yellow := image.NewUniform(color.NRGBA{255, 255, 0, 255})
+	r := rects[c.active]
+	for _, edge := range []image.Rectangle{
+		image.Rect(r.Min.X, r.Min.Y, r.Max.X, r.Min.Y+activeBorder),
+		image.Rect(r.Min.X, r.Max.Y-activeBorder, r.Max.X, r.Max.Y),
+		image.Rect(r.Min.X, r.Min.Y, r.Min.X+activeBorder, r.Max.Y),
+		image.Rect(r.Max.X-activeBorder, r.Min.Y, r.Max.X, r.Max.Y),
+	} {
+		draw.Draw(rgba, edge, yellow, image.Point{}, draw.Src)
+	}
+	a.iCanvas.Refresh()
+	a.compareLabels()
+}
+
+// compareLabels updates the name and rating displayed on each panel.
+func (a *Ptag) compareLabels() {
+	c := a.compare
+	for i, index := range c.panels {
+		p := a.picts[index]
+		rating := "-"
+		if r, err := p.Rating(); err == nil && r >= 0 {
+			rating = fmt.Sprintf("%d", r)
+		}
+		label := fmt.Sprintf("%s  Rating: %s", p.Name(), rating)
+		if i == 0 {
+			label = "Pick: " + label
+		}
+		c.labels[i].Text = label
+		if i == c.active {
+			c.labels[i].Color = color.NRGBA{255, 255, 0, 255}
+		} else {
+			c.labels[i].Color = color.White
+		}
+		c.labels[i].Refresh()
+	}
+}
@@ -0,0 +1,223 @@
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+// Caption autocompletion.
+// Suggestions are drawn from the captions of the images (which are
+// scanned in the background), and from a vocabulary file.
+// When editing on hover, the caption stays in edit while suggestions are
+// displayed, so that the mouse can be moved off the caption to select a suggestion.
+
+import (
+	"bufio"
+	"image/color"
+	"os"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"fyne.io/fyne/v2/canvas"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/widget"
+)
+
+const (
+	maxSuggestions = 8    // Maximum number of suggestions displayed
+	minPrefix      = 2    // Minimum characters typed before suggesting
+	minWord        = 3    // Minimum length of words taken from captions
+	vocabWeight    = 1000 // Vocabulary terms are suggested before other terms
+)
+
+// Terms read from the vocabulary file.
+var vocabulary []string
+
+// readVocabulary reads a file of terms (names, places etc.), one per line.
+// Blank lines and lines starting with '#' are ignored.
+func readVocabulary(file string) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		t := strings.TrimSpace(scanner.Text())
+		if len(t) == 0 || strings.HasPrefix(t, "#") {
+			continue
+		}
+		vocabulary = append(vocabulary, t)
+	}
+	return scanner.Err()
+}
+
+// newCompleter creates the completer, initialised with the vocabulary.
+func newCompleter() *Completer {
+	c := &Completer{terms: map[string]int{}, items: container.NewVBox()}
+	bg := canvas.NewRectangle(color.NRGBA{0, 0, 0, 200})
+	c.box = container.NewHBox(container.NewStack(bg, c.items))
+	c.box.Hide()
+	for _, v := range vocabulary {
+		c.terms[v] += vocabWeight
+	}
+	return c
+}
+
+// addCaption adds the caption, its comma separated parts and its words to the terms.
+func (c *Completer) addCaption(caption string) {
+	caption = strings.TrimSpace(caption)
+	if len(caption) == 0 {
+		return
+	}
+	t := map[string]nothing{caption: {}}
+	for _, part := range strings.FieldsFunc(caption, func(r rune) bool { return r == ',' || r == ';' }) {
+		if part = strings.TrimSpace(part); len(part) != 0 {
+			t[part] = nothing{}
+		}
+	}
+	for _, w := range strings.FieldsFunc(caption, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '\'' && r != '-'
+	}) {
+		if utf8.RuneCountInString(w) >= minWord {
+			t[w] = nothing{}
+		}
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	for k := range t {
+		c.terms[k]++
+	}
+}
+
+// match returns the terms that complete the end of the text.
+// Longer matches (e.g a phrase) are preferred to shorter matches (e.g the last word),
+// and more frequently seen terms are preferred.
+func (c *Completer) match(text string) []completion {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	var m []completion
+	seen := map[string]nothing{}
+	for start := 0; start < len(text) && len(m) < maxSuggestions; start++ {
+		if start > 0 && !strings.ContainsRune(" ,;(", rune(text[start-1])) {
+			continue
+		}
+		prefix := strings.ToLower(text[start:])
+		if utf8.RuneCountInString(prefix) < minPrefix || prefix[0] == ' ' {
+			continue
+		}
+		var found []string
+		for t := range c.terms {
+			if _, ok := seen[t]; !ok && len(t) > len(prefix) && strings.HasPrefix(strings.ToLower(t), prefix) {
+				found = append(found, t)
+			}
+		}
+		sort.Slice(found, func(i, j int) bool {
+			if c.terms[found[i]] != c.terms[found[j]] {
+				return c.terms[found[i]] > c.terms[found[j]]
+			}
+			return found[i] < found[j]
+		})
+		for _, t := range found {
+			if len(m) == maxSuggestions {
+				break
+			}
+			seen[t] = nothing{}
+			m = append(m, completion{t, start})
+		}
+	}
+	return m
+}
+
+// scanCaptions reads the captions of the images in the background
+// to add them to the completion terms. Only the EXIF data is read, so the
+// scan does not wait for or change the loading of the images.
+func (a *Ptag) scanCaptions(picts []*Pict) {
+	for _, p := range picts {
+		p.loadExif(nil)
+		if c, ok := p.getExif(EXIV_HEADLINE); ok {
+			a.completer.addCaption(c)
+		}
+	}
+}
+
+// suggest displays the completions for the caption text.
+func (a *Ptag) suggest(text string) {
+	c := a.completer
+	if c.quiet {
+		return
+	}
+	c.matched = nil
+	if a.win.Canvas().Focused() == a.caption {
+		c.matched = c.match(text)
+	}
+	if len(c.matched) == 0 {
+		c.box.Hide()
+		return
+	}
+	c.items.RemoveAll()
+	for i, m := range c.matched {
+		i := i
+		b := widget.NewButton(m.term, func() { a.locked(func() { a.acceptSuggestion(i) }) })
+		b.Alignment = widget.ButtonAlignLeading
+		c.items.Add(b)
+	}
+	c.selected = 0
+	c.highlight()
+	c.box.Show()
+}
+
+// highlight shows which suggestion is selected.
+func (c *Completer) highlight() {
+	for i, o := range c.items.Objects {
+		b := o.(*widget.Button)
+		if i == c.selected {
+			b.Importance = widget.HighImportance
+		} else {
+			b.Importance = widget.LowImportance
+		}
+		b.Refresh()
+	}
+}
+
+// moveSuggestion changes the selected suggestion.
+func (a *Ptag) moveSuggestion(delta int) {
+	c := a.completer
+	c.selected = (c.selected + delta + len(c.matched)) % len(c.matched)
+	c.highlight()
+}
+
+// acceptSuggestion replaces the end of the caption with the suggestion.
+func (a *Ptag) acceptSuggestion(i int) {
+	c := a.completer
+	if i < 0 || i >= len(c.matched) {
+		return
+	}
+	m := c.matched[i]
+	text := a.caption.Text[:m.start] + m.term
+	c.box.Hide()
+	c.quiet = true
+	a.caption.SetText(text)
+	c.quiet = false
+	a.caption.CursorColumn = utf8.RuneCountInString(text)
+	a.caption.Refresh()
+	a.closeSuggestions()
+}
+
+// closeSuggestions hides the suggestions. When editing on hover, the
+// edit is finished if the mouse has left the caption.
+func (a *Ptag) closeSuggestions() {
+	a.completer.box.Hide()
+	if *hover && !a.caption.mouseIn {
+		a.win.Canvas().Unfocus()
+	}
+}
@@ -0,0 +1,352 @@
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+// Contact (proof) sheets.
+// The images are laid out in a grid, with the file name, rating and
+// caption under each image. A PDF has A4 pages, and a JPEG is a single
+// sheet that is as long as needed to hold all the images.
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/jpeg"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/storage"
+	"fyne.io/fyne/v2/theme"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/math/fixed"
+)
+
+// JPEG quality of the sheets.
+const sheetQuality = 90
+
+// Maximum width or height of a JPEG.
+const maxJpegSize = 65535
+
+// Maximum memory used for the image of a JPEG sheet, in bytes.
+const maxSheetMemory = 256 << 20
+
+// Size of an A4 PDF page, in points.
+const (
+	pdfWidth  = 595
+	pdfHeight = 842
+)
+
+// newSheetLayout calculates the layout of a sheet of the width (in pixels),
+// holding n images. If paged is set, the sheet is split into A4 pages.
+// Otherwise the sheet is a single JPEG, which is checked against the
+// maximum JPEG size and the memory used to render it before any image is read.
+func newSheetLayout(width, cols, n int, paged bool) (*sheetLayout, error) {
+	if cols < 1 || width < cols*50 {
+		return nil, fmt.Errorf("sheet too narrow for %d columns", cols)
+	}
+	if !paged && width > maxJpegSize {
+		return nil, fmt.Errorf("JPEG sheet wider than %d pixels", maxJpegSize)
+	}
+	l := &sheetLayout{width: width, cols: cols, margin: width / 40}
+	l.cellW = (width - 2*l.margin) / cols
+	pad := l.cellW / 20
+	l.imgW = l.cellW - 2*pad
+	l.imgH = l.imgW * 3 / 4
+	f, err := opentype.Parse(theme.DefaultTextFont().Content())
+	if err != nil {
+		return nil, err
+	}
+	l.face, err = opentype.NewFace(f, &opentype.FaceOptions{Size: float64(max(l.cellW/16, 10)), DPI: 72, Hinting: font.HintingFull})
+	if err != nil {
+		return nil, err
+	}
+	l.lineH = l.face.Metrics().Height.Ceil()
+	l.cellH = l.imgH + 2*l.lineH + 3*pad
+	if paged {
+		l.height = width * pdfHeight / pdfWidth
+		l.rows = max((l.height-2*l.margin)/l.cellH, 1)
+	} else {
+		l.rows = max((n+cols-1)/cols, 1)
+		l.height = l.rows*l.cellH + 2*l.margin
+		// The sheet is rendered as RGBA, using 4 bytes per pixel.
+		if maxH := min(maxJpegSize, maxSheetMemory/(4*width)); l.height > maxH {
+			most := max(maxH-2*l.margin, 0) / l.cellH * cols
+			return nil, fmt.Errorf("too many images for a JPEG sheet (%d, at most %d with %d columns), use a PDF or more columns", n, most, cols)
+		}
+	}
+	return l, nil
+}
+
+// newSheetEntry creates the sheet entry for the image, using the caption field.
+func newSheetEntry(p *Pict, img image.Image, field int) sheetEntry {
+	e := sheetEntry{img: img, name: p.Name()}
+	e.caption, _ = p.Field(field)
+	var err error
+	if e.rating, err = p.Rating(); err != nil {
+		e.rating = -1
+	}
+	return e
+}
+
+// fitText shortens the text so that it fits within the width.
+func fitText(face font.Face, s string, w int) string {
+	if font.MeasureString(face, s).Ceil() <= w {
+		return s
+	}
+	r := []rune(s)
+	for len(r) > 0 {
+		r = r[:len(r)-1]
+		if t := strings.TrimSpace(string(r)) + "…"; font.MeasureString(face, t).Ceil() <= w {
+			return t
+		}
+	}
+	return ""
+}
+
+// render draws the entries on pages.
+func (l *sheetLayout) render(entries []sheetEntry) []image.Image {
+	var pages []image.Image
+	perPage := l.cols * l.rows
+	pad := l.cellW / 20
+	for start := 0; start < len(entries); start += perPage {
+		page := image.NewRGBA(image.Rect(0, 0, l.width, l.height))
+		draw.Draw(page, page.Bounds(), image.White, image.Point{}, draw.Src)
+		d := &font.Drawer{Dst: page, Src: image.NewUniform(color.Gray{64}), Face: l.face}
+		for i, e := range entries[start:min(start+perPage, len(entries))] {
+			x := l.margin + i%l.cols*l.cellW + pad
+			y := l.margin + i/l.cols*l.cellH + pad
+			// Centre the image in its box.
+			b := e.img.Bounds()
+			r := image.Rect(0, 0, b.Dx(), b.Dy()).Add(image.Pt(x+(l.imgW-b.Dx())/2, y+(l.imgH-b.Dy())/2))
+			draw.Draw(page, r, e.img, b.Min, draw.Src)
+			label := e.name
+			if e.rating >= 0 {
+				// The text font has no star symbols.
+				label += "  " + strings.Repeat("*", e.rating) + strings.Repeat("-", 5-e.rating)
+			}
+			base := y + l.imgH + pad + l.face.Metrics().Ascent.Ceil()
+			for _, s := range []string{label, e.caption} {
+				d.Dot = fixed.P(x, base)
+				d.DrawString(fitText(l.face, s, l.imgW))
+				base += l.lineH
+			}
+		}
+		pages = append(pages, page)
+	}
+	return pages
+}
+
+// writePDF writes the pages as a PDF, with each page as a JPEG image.
+func writePDF(w io.Writer, pages []image.Image) error {
+	var buf bytes.Buffer
+	var offsets []int
+	obj := func(format string, args ...any) {
+		offsets = append(offsets, buf.Len())
+		fmt.Fprintf(&buf, "%d 0 obj\n", len(offsets))
+		fmt.Fprintf(&buf, format, args...)
+		buf.WriteString("\nendobj\n")
+	}
+	buf.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+	obj("<< /Type /Catalog /Pages 2 0 R >>")
+	var kids []string
+	for i := range pages {
+		kids = append(kids, fmt.Sprintf("%d 0 R", 3+3*i))
+	}
+	obj("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(pages))
+	for i, pg := range pages {
+		var img bytes.Buffer
+		if err := jpeg.Encode(&img, pg, &jpeg.Options{Quality: sheetQuality}); err != nil {
+			return err
+		}
+		b := pg.Bounds()
+		h := pdfWidth * b.Dy() / b.Dx()
+		page := 3 + 3*i
+		obj("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %d %d] /Resources << /XObject << /Im0 %d 0 R >> >> /Contents %d 0 R >>",
+			pdfWidth, h, page+2, page+1)
+		content := fmt.Sprintf("q %d 0 0 %d 0 0 cm /Im0 Do Q", pdfWidth, h)
+		obj("<< /Length %d >>\nstream\n%s\nendstream", len(content), content)
+		obj("<< /Type /XObject /Subtype /Image /Width %d /Height %d /ColorSpace /DeviceRGB /BitsPerComponent 8 /Filter /DCTDecode /Length %d >>\nstream\n%s\nendstream",
+			b.Dx(), b.Dy(), img.Len(), img.Bytes())
+	}
+	xref := buf.Len()
+	fmt.Fprintf(&buf, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, o := range offsets {
+		fmt.Fprintf(&buf, "%010d 00000 n \n", o)
+	}
+	fmt.Fprintf(&buf, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets)+1, xref)
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// isPDF returns true if the sheet file is a PDF, and false if it is a JPEG.
+func isPDF(file string) (bool, error) {
+	switch strings.ToLower(filepath.Ext(file)) {
+	case ".pdf":
+		return true, nil
+	case ".jpg", ".jpeg":
+		return false, nil
+	}
+	return false, fmt.Errorf("%s: contact sheet must be a .pdf or .jpg file", file)
+}
+
+// writeSheet renders the entries and writes the contact sheet.
+// Entries without an image are skipped.
+func writeSheet(file string, l *sheetLayout, entries []sheetEntry) error {
+	var e []sheetEntry
+	for _, s := range entries {
+		if s.img != nil {
+			e = append(e, s)
+		}
+	}
+	if len(e) == 0 {
+		return fmt.Errorf("no images")
+	}
+	pdf, err := isPDF(file)
+	if err != nil {
+		return err
+	}
+	pages := l.render(e)
+	f, err := os.Create(file)
+	if err != nil {
+		return err
+	}
+	if pdf {
+		err = writePDF(f, pages)
+	} else {
+		err = jpeg.Encode(f, pages[0], &jpeg.Options{Quality: sheetQuality})
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// sheetCmd writes a contact sheet of the images on the command line.
+func sheetCmd(args []string) error {
+	fs := flag.NewFlagSet("sheet", flag.ExitOnError)
+	out := fs.String("o", "contact.pdf", "Contact sheet file (.pdf or .jpg)")
+	cols := fs.Int("cols", *sheetCols, "Number of columns")
+	width := fs.Int("width", *sheetWidth, "Width of the sheet in pixels")
+	rating := fs.Int("rating", -1, "Only include images with at least this rating")
+	fs.Parse(args)
+	pdf, err := isPDF(*out)
+	if err != nil {
+		return err
+	}
+	files := expand(fs.Args())
+	if len(files) == 0 {
+		return fmt.Errorf("no images")
+	}
+	picts := ratedPicts(files, *rating)
+	if len(picts) == 0 {
+		return fmt.Errorf("no images with a rating of at least %d", *rating)
+	}
+	l, err := newSheetLayout(*width, *cols, len(picts), pdf)
+	if err != nil {
+		return err
+	}
+	entries := make([]sheetEntry, len(picts))
+	index := make(map[*Pict]int)
+	for i, p := range picts {
+		index[p] = i
+	}
+	failed := runCmd(picts, func(p *Pict) (string, error) {
+		img, err := p.Thumbnail(l.imgW, l.imgH)
+		if err != nil {
+			return "", err
+		}
+		entries[index[p]] = newSheetEntry(p, img, EXIV_HEADLINE)
+		return p.Path(), nil
+	})
+	if err := writeSheet(*out, l, entries); err != nil {
+		return err
+	}
+	if failed != 0 {
+		return fmt.Errorf("%d images failed", failed)
+	}
+	fmt.Printf("Contact sheet written to %s\n", *out)
+	return nil
+}
+
+// contactSheet writes a contact sheet of the marked images,
+// or the displayed images if none are marked.
+func (a *Ptag) contactSheet() {
+	picts := a.marked()
+	if len(picts) == 0 {
+		picts = a.picts
+	}
+	field := a.captionField()
+	d := dialog.NewFileSave(func(w fyne.URIWriteCloser, err error) {
+		a.lock.Lock()
+		defer a.lock.Unlock()
+		if err != nil || w == nil {
+			return
+		}
+		w.Close()
+		file := w.URI().Path()
+		pdf, err := isPDF(file)
+		if err == nil {
+			var l *sheetLayout
+			if l, err = newSheetLayout(*sheetWidth, *sheetCols, len(picts), pdf); err == nil {
+				a.makeSheet(file, l, picts, field)
+				return
+			}
+		}
+		os.Remove(file)
+		a.setStatus(fmt.Sprintf("Failed to write contact sheet: %v", err))
+	}, a.win)
+	d.SetFileName("contact.pdf")
+	d.SetFilter(storage.NewExtensionFileFilter([]string{".pdf", ".jpg", ".jpeg"}))
+	d.Show()
+}
+
+// makeSheet reads the images in the background, and writes the contact sheet.
+// The sheet is rendered and written by the worker that reads the last image,
+// so that only the status is shown with the lock held.
+func (a *Ptag) makeSheet(file string, l *sheetLayout, picts []*Pict, field int) {
+	entries := make([]sheetEntry, len(picts))
+	index := make(map[*Pict]int)
+	for i, p := range picts {
+		index[p] = i
+	}
+	left := int32(len(picts))
+	var werr error
+	a.runBatch("Contact sheet", picts, false, func(p *Pict) error {
+		defer func() {
+			if atomic.AddInt32(&left, -1) == 0 {
+				werr = writeSheet(file, l, entries)
+			}
+		}()
+		img, err := p.Thumbnail(l.imgW, l.imgH)
+		if err != nil {
+			return err
+		}
+		entries[index[p]] = newSheetEntry(p, img, field)
+		return nil
+	}, func() {
+		if werr != nil {
+			a.setStatus(fmt.Sprintf("Failed to write contact sheet: %v", werr))
+			return
+		}
+		a.setStatus(fmt.Sprintf("Contact sheet written to %s", file))
+	})
+}
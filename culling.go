@@ -0,0 +1,200 @@
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+// Culling actions that move, copy or trash the current image,
+// and the undo list.
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// targetDir returns the directory to use for the image.
+// A relative directory is relative to the directory of the image.
+func targetDir(p *Pict, dir string) string {
+	if filepath.IsAbs(dir) {
+		return dir
+	}
+	return filepath.Join(filepath.Dir(p.Path()), dir)
+}
+
+// reject moves the current image and its associated files to the reject directory.
+func (a *Ptag) reject() {
+	a.removeCurrent("reject", func(files []string) ([]moved, error) {
+		return transfer(files, targetDir(a.picts[a.index], *rejectDir), true)
+	}, func(m []moved) error {
+		return revert(m, true)
+	})
+}
+
+// trash moves the current image and its associated files to the trash.
+func (a *Ptag) trash() {
+	a.removeCurrent("trash", trashFiles, untrash)
+}
+
+// removeCurrent removes the current image from the display after
+// the files have been moved elsewhere, and records how to undo the move.
+func (a *Ptag) removeCurrent(op string, do func([]string) ([]moved, error), undo func([]moved) error) {
+	if len(a.picts) <= 1 {
+		fmt.Fprintf(os.Stderr, "%s: cannot remove the last image\n", op)
+		return
+	}
+	a.Sync()
+	a.stopCompare()
+	p := a.picts[a.index]
+	// Wait for any loading to complete before the file is moved.
+	p.Unload()
+	m, err := do(companions(p.Path()))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %s: %v\n", p.Name(), op, err)
+		a.redisplay()
+		return
+	}
+	a.removePict(p)
+	a.pushUndo(fmt.Sprintf("%s %s", op, p.Name()), func() error {
+		if err := undo(m); err != nil {
+			return err
+		}
+		a.insertPict(p)
+		return nil
+	})
+	a.setStatus(fmt.Sprintf("%s: %d file(s)", op, len(m)))
+}
+
+// pick copies the current image and its associated files to the picks directory.
+func (a *Ptag) pick() {
+	a.Sync()
+	p := a.picts[a.index]
+	m, err := transfer(companions(p.Path()), targetDir(p, *picksDir), false)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: copy: %v\n", p.Name(), err)
+		return
+	}
+	a.pushUndo(fmt.Sprintf("copy %s", p.Name()), func() error {
+		return revert(m, false)
+	})
+	a.setStatus(fmt.Sprintf("Copied %d file(s) to %s", len(m), filepath.Dir(m[0].to)))
+}
+
+// removePict removes the image from the lists of images, and updates
+// the cache so that it refers to the new indices.
+func (a *Ptag) removePict(p *Pict) {
+	cached := a.cached()
+	for i, ap := range a.all {
+		if ap == p {
+			a.all = append(a.all[:i:i], a.all[i+1:]...)
+			break
+		}
+	}
+	if a.stacks != nil {
+		a.picts = a.stacked()
+	} else if a.filter == nil {
+		a.picts = a.all
+	} else {
+		for i, ap := range a.picts {
+			if ap == p {
+				a.picts = append(a.picts[:i:i], a.picts[i+1:]...)
+				break
+			}
+		}
+	}
+	a.recache(cached)
+	if a.index >= len(a.picts) {
+		a.index = len(a.picts) - 1
+	}
+	a.retitle()
+	a.setIndex(a.index)
+}
+
+// insertPict restores an image that was removed back into
+// its original position in the lists of images.
+func (a *Ptag) insertPict(p *Pict) {
+	insert := func(l []*Pict) []*Pict {
+		i := sort.Search(len(l), func(i int) bool { return l[i].seq > p.seq })
+		l = append(l[:i:i], append([]*Pict{p}, l[i:]...)...)
+		return l
+	}
+	cached := a.cached()
+	a.all = insert(a.all)
+	if a.stacks != nil {
+		a.picts = a.stacked()
+	} else if a.filter == nil {
+		a.picts = a.all
+	} else if a.filter.match(p) {
+		a.picts = insert(a.picts)
+	}
+	a.recache(cached)
+	a.retitle()
+	for i, ap := range a.picts {
+		if ap == p || a.stacks.same(ap, p) {
+			a.index = i
+		}
+	}
+	a.setIndex(a.index)
+}
+
+// cached returns the images that are in the cache.
+func (a *Ptag) cached() []*Pict {
+	var c []*Pict
+	for k := range a.loaded {
+		c = append(c, a.picts[k])
+	}
+	return c
+}
+
+// recache rebuilds the cache map after the list of images has changed,
+// unloading any cached images that are no longer displayed.
+func (a *Ptag) recache(cached []*Pict) {
+	pos := map[*Pict]int{}
+	for i, p := range a.picts {
+		pos[p] = i
+	}
+	a.loaded = map[int]nothing{}
+	for _, p := range cached {
+		if i, ok := pos[p]; ok {
+			a.loaded[i] = nothing{}
+		} else {
+			p.Unload()
+		}
+	}
+}
+
+// pushUndo records how to undo an action.
+func (a *Ptag) pushUndo(name string, f func() error) {
+	a.undoList = append(a.undoList, undoItem{name, f})
+}
+
+// undo reverses the last action on the undo list.
+func (a *Ptag) undo() {
+	if len(a.undoList) == 0 {
+		a.setStatus("Nothing to undo")
+		return
+	}
+	// Some actions are undone by a batch operation, so the undo is
+	// kept until the running batch operation has completed.
+	if a.progress.running {
+		a.setStatus("Batch operation running, cannot undo")
+		return
+	}
+	u := a.undoList[len(a.undoList)-1]
+	a.undoList = a.undoList[:len(a.undoList)-1]
+	if err := u.undo(); err != nil {
+		fmt.Fprintf(os.Stderr, "undo %s: %v\n", u.name, err)
+		a.setStatus(fmt.Sprintf("Undo %s failed: %v", u.name, err))
+		return
+	}
+	a.setStatus(fmt.Sprintf("Undo %s", u.name))
+}
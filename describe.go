@@ -0,0 +1,80 @@
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+// Editor for the title, headline and description of the current image.
+// The title and description are edited in the selected language.
+
+import (
+	"fmt"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+)
+
+// Number of lines shown in the description editor.
+const descriptionRows = 6
+
+// editDescription displays a form for editing the title, headline and description.
+func (a *Ptag) editDescription() {
+	a.Sync()
+	p := a.picts[a.index]
+	fields := []struct {
+		name  string
+		tag   int
+		entry *widget.Entry
+	}{
+		{"Title", langField(EXIV_TITLE, a.lang), widget.NewEntry()},
+		{"Headline", EXIV_HEADLINE, widget.NewEntry()},
+		{"Description", langField(EXIV_DESCRIPTION, a.lang), widget.NewMultiLineEntry()},
+	}
+	if a.lang != defaultLang {
+		fields[0].name += fmt.Sprintf(" (%s)", a.lang)
+		fields[2].name += fmt.Sprintf(" (%s)", a.lang)
+	}
+	var items []*widget.FormItem
+	for _, f := range fields {
+		v, err := p.Field(f.tag)
+		if err != nil {
+			a.setStatus(fmt.Sprintf("Failed to read %s: %v", f.name, err))
+			return
+		}
+		f.entry.SetText(v)
+		items = append(items, widget.NewFormItem(f.name, f.entry))
+	}
+	fields[2].entry.Wrapping = fyne.TextWrapWord
+	fields[2].entry.SetMinRowsVisible(descriptionRows)
+	d := dialog.NewForm(p.Name(), "Save", "Cancel", items, func(ok bool) {
+		a.lock.Lock()
+		defer a.lock.Unlock()
+		if !ok {
+			return
+		}
+		for _, f := range fields {
+			if v, _ := p.Field(f.tag); v == f.entry.Text {
+				continue
+			}
+			if err := p.SetField(f.tag, f.entry.Text); err != nil {
+				a.setStatus(fmt.Sprintf("Failed to set %s: %v", f.name, err))
+				return
+			}
+		}
+		// The headline or description is also displayed as the caption.
+		if a.picts[a.index] == p {
+			a.showCaption()
+		}
+	}, a.win)
+	d.Resize(fyne.NewSize(a.win.Canvas().Size().Width*0.6, 0))
+	d.Show()
+}
@@ -0,0 +1,308 @@
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+// Duplicate detection and review.
+// Each image has a perceptual (difference) hash, calculated when the
+// image is loaded, or by reading the image when required. Images whose
+// hashes differ by no more than -dupdistance bits are near duplicates,
+// and images whose files have the same checksum are exact duplicates.
+// In review mode, each group of duplicates is displayed in compare mode,
+// and the selected image can be kept and the others rejected or trashed.
+
+import (
+	"flag"
+	"fmt"
+	"image"
+	"image/color"
+	"math/bits"
+	"sort"
+	"sync"
+)
+
+// Maximum size of the image used to calculate the hash when the image is not loaded.
+const hashSize = 256
+
+// imageHash calculates the difference hash of the image. The image is
+// reduced to 9x8 grey cells, and each bit is set if a cell is brighter
+// than the cell to its right.
+func imageHash(img image.Image) uint64 {
+	b := img.Bounds()
+	var cells [8][9]float64
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 9; x++ {
+			cells[y][x] = meanGrey(img, image.Rect(b.Min.X+x*b.Dx()/9, b.Min.Y+y*b.Dy()/8,
+				b.Min.X+(x+1)*b.Dx()/9, b.Min.Y+(y+1)*b.Dy()/8))
+		}
+	}
+	var h uint64
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 8; x++ {
+			h <<= 1
+			if cells[y][x] > cells[y][x+1] {
+				h |= 1
+			}
+		}
+	}
+	return h
+}
+
+// meanGrey returns the mean grey level of the area, sampling at most 16x16 pixels.
+func meanGrey(img image.Image, r image.Rectangle) float64 {
+	sx := max(r.Dx()/16, 1)
+	sy := max(r.Dy()/16, 1)
+	var sum float64
+	n := 0
+	for y := r.Min.Y; y < r.Max.Y; y += sy {
+		for x := r.Min.X; x < r.Max.X; x += sx {
+			sum += float64(color.GrayModel.Convert(img.At(x, y)).(color.Gray).Y)
+			n++
+		}
+	}
+	if n == 0 {
+		return 0
+	}
+	return sum / float64(n)
+}
+
+// groupDuplicates returns the groups of duplicate images, in the order
+// of the images. The images must have been hashed.
+func groupDuplicates(picts []*Pict, maxDist int) []dupGroup {
+	parent := make([]int, len(picts))
+	for i := range parent {
+		parent[i] = i
+	}
+	var find func(int) int
+	find = func(i int) int {
+		if parent[i] != i {
+			parent[i] = find(parent[i])
+		}
+		return parent[i]
+	}
+	hashes := make([]uint64, len(picts))
+	sums := make([][32]byte, len(picts))
+	for i, p := range picts {
+		hashes[i], sums[i], _ = p.Hashes()
+	}
+	for i := range picts {
+		for j := i + 1; j < len(picts); j++ {
+			if sums[i] == sums[j] || bits.OnesCount64(hashes[i]^hashes[j]) <= maxDist {
+				parent[find(j)] = find(i)
+			}
+		}
+	}
+	index := make(map[int]int)
+	var groups []dupGroup
+	var first []int // First image of each group
+	for i, p := range picts {
+		root := find(i)
+		g, ok := index[root]
+		if !ok {
+			g = len(groups)
+			index[root] = g
+			groups = append(groups, dupGroup{exact: true})
+			first = append(first, i)
+		}
+		if sums[first[g]] != sums[i] {
+			groups[g].exact = false
+		}
+		groups[g].picts = append(groups[g].picts, p)
+	}
+	var dups []dupGroup
+	for _, g := range groups {
+		if len(g.picts) > 1 {
+			dups = append(dups, g)
+		}
+	}
+	return dups
+}
+
+// describe returns whether the images in the group are identical or similar.
+func (g dupGroup) describe() string {
+	if g.exact {
+		return "identical"
+	}
+	return "similar"
+}
+
+// dupsCmd lists the groups of duplicate images on the command line.
+func dupsCmd(args []string) error {
+	fs := flag.NewFlagSet("dups", flag.ExitOnError)
+	fs.Parse(args)
+	files := expand(fs.Args())
+	if len(files) == 0 {
+		return fmt.Errorf("no images")
+	}
+	var picts []*Pict
+	for i, f := range files {
+		picts = append(picts, NewPict(f, i))
+	}
+	var lock sync.Mutex
+	var hashed []*Pict
+	runCmd(picts, func(p *Pict) (string, error) {
+		if _, _, err := p.Hashes(); err != nil {
+			return "", err
+		}
+		lock.Lock()
+		hashed = append(hashed, p)
+		lock.Unlock()
+		return "", nil
+	})
+	sort.Slice(hashed, func(i, j int) bool { return hashed[i].seq < hashed[j].seq })
+	groups := groupDuplicates(hashed, *dupDistance)
+	n := 0
+	for i, g := range groups {
+		fmt.Printf("Group %d (%s):\n", i+1, g.describe())
+		for _, p := range g.picts {
+			fmt.Printf("  %s\n", p.Path())
+		}
+		n += len(g.picts) - 1
+	}
+	fmt.Printf("%d groups, %d duplicate images\n", len(groups), n)
+	return nil
+}
+
+// findDuplicates hashes all the images in the background, and then
+// starts reviewing the groups of duplicates. Stacks are turned off
+// during the review.
+func (a *Ptag) findDuplicates() {
+	var lock sync.Mutex
+	var hashed []*Pict
+	a.runBatch("Find duplicates", a.all, false, func(p *Pict) error {
+		if _, _, err := p.Hashes(); err != nil {
+			return err
+		}
+		lock.Lock()
+		hashed = append(hashed, p)
+		lock.Unlock()
+		return nil
+	}, func() {
+		sort.Slice(hashed, func(i, j int) bool { return hashed[i].seq < hashed[j].seq })
+		groups := groupDuplicates(hashed, *dupDistance)
+		if len(groups) == 0 {
+			a.setStatus("No duplicates found")
+			return
+		}
+		a.stopReview()
+		a.review = &Review{groups: groups, filter: a.filter, stacks: a.stacks}
+		a.stacks = nil
+		a.showGroup()
+	})
+}
+
+// showGroup displays the images of the group being reviewed in compare mode.
+// Groups that no longer have more than one image are skipped. An image
+// kept from the group is displayed first, so that it is compared with
+// the images that have not been displayed yet.
+func (a *Ptag) showGroup() {
+	r := a.review
+	all := make(map[*Pict]nothing)
+	for _, p := range a.all {
+		all[p] = nothing{}
+	}
+	for ; r.group < len(r.groups); r.group++ {
+		g := r.groups[r.group]
+		var picts []*Pict
+		members := make(map[*Pict]nothing)
+		for _, p := range g.picts {
+			if _, ok := all[p]; ok {
+				if p == r.keep {
+					picts = append([]*Pict{p}, picts...)
+				} else {
+					picts = append(picts, p)
+				}
+				members[p] = nothing{}
+			}
+		}
+		if len(picts) < 2 {
+			continue
+		}
+		a.stopCompare()
+		a.flushCache()
+		a.filter = &filter{fmt.Sprintf("Duplicates %d/%d", r.group+1, len(r.groups)), func(p *Pict) bool {
+			_, ok := members[p]
+			return ok
+		}}
+		a.picts = picts
+		a.index = 0
+		a.retitle()
+		a.startCompare(min(len(picts), 4))
+		a.setStatus(fmt.Sprintf("%d %s images", len(picts), g.describe()))
+		return
+	}
+	a.stopReview()
+	a.setStatus("Duplicate review finished")
+}
+
+// nextGroup moves to the next group of duplicates.
+func (a *Ptag) nextGroup() {
+	if a.review == nil {
+		a.setStatus("Not reviewing duplicates")
+		return
+	}
+	a.review.group++
+	a.review.keep = nil
+	a.showGroup()
+}
+
+// keepDuplicate keeps the selected image of the group being reviewed,
+// and removes the other displayed images using remove (e.g reject or trash).
+// A group may have more images than can be displayed, so the kept image
+// is then compared with the rest of the group.
+func (a *Ptag) keepDuplicate(remove func()) {
+	if a.review == nil {
+		a.setStatus("Not reviewing duplicates")
+		return
+	}
+	if a.compare == nil {
+		// Only the images that have been compared are removed.
+		a.showGroup()
+		return
+	}
+	keep := a.picts[a.index]
+	var shown []*Pict
+	for _, i := range a.compare.panels {
+		shown = append(shown, a.picts[i])
+	}
+	// Compare mode would select the pick when the images are removed.
+	a.stopCompare()
+	for _, p := range shown {
+		if p == keep {
+			continue
+		}
+		// Removing an image changes the displayed images,
+		// so the image is found each time.
+		for i, dp := range a.picts {
+			if dp == p {
+				a.index = i
+				remove()
+				break
+			}
+		}
+	}
+	a.review.keep = keep
+	a.showGroup()
+}
+
+// stopReview leaves the duplicate review, and restores the previous
+// filter and stacks.
+func (a *Ptag) stopReview() {
+	r := a.review
+	if r == nil {
+		return
+	}
+	a.review = nil
+	a.stopCompare()
+	a.stacks = r.stacks
+	a.applyFilter(r.filter)
+}
@@ -20,30 +20,119 @@ package main
 import (
 	"fmt"
 	"os"
+	"os/exec"
+	"sort"
 	"strings"
+	"unicode/utf8"
 )
 
-// maps the internal EXIF enum to the EXIF tag string
-var exivToSet = map[int]string{
-	EXIV_RATING:      "Xmp.xmp.Rating",
-	EXIV_HEADLINE:    "Iptc.Application2.Headline",
-	EXIV_ORIENTATION: "Exif.Image.Orientation",
+// maps the internal EXIF enum to the EXIF tag strings that are read,
+// in order of preference. The tags that are written are also read.
+var exivToGet = map[int][]string{
+	EXIV_RATING:            {"Xmp.xmp.Rating"},
+	EXIV_HEADLINE:          {"Iptc.Application2.Headline", "Xmp.photoshop.Headline"},
+	EXIV_ORIENTATION:       {"Exif.Image.Orientation"},
+	EXIV_LABEL:             {"Xmp.xmp.Label"},
+	EXIV_TITLE:             {"Iptc.Application2.ObjectName", "Xmp.dc.title"},
+	EXIV_DESCRIPTION:       {"Iptc.Application2.Caption", "Xmp.dc.description"},
+	EXIV_KEYWORDS:          {"Xmp.lr.hierarchicalSubject"},
+	EXIV_SUBJECT:           {"Xmp.dc.subject"},
+	EXIV_GPS_LATITUDE:      {"Exif.GPSInfo.GPSLatitude"},
+	EXIV_GPS_LATITUDE_REF:  {"Exif.GPSInfo.GPSLatitudeRef"},
+	EXIV_GPS_LONGITUDE:     {"Exif.GPSInfo.GPSLongitude"},
+	EXIV_GPS_LONGITUDE_REF: {"Exif.GPSInfo.GPSLongitudeRef"},
+	EXIV_GPS_ALTITUDE:      {"Exif.GPSInfo.GPSAltitude"},
+	EXIV_GPS_ALTITUDE_REF:  {"Exif.GPSInfo.GPSAltitudeRef"},
+	EXIV_CITY:              {"Iptc.Application2.City", "Xmp.photoshop.City"},
+	EXIV_STATE:             {"Iptc.Application2.ProvinceState", "Xmp.photoshop.State"},
+	EXIV_COUNTRY:           {"Iptc.Application2.CountryName", "Xmp.photoshop.Country"},
+	EXIV_MAKE:              {"Exif.Image.Make"},
+	EXIV_MODEL:             {"Exif.Image.Model"},
+	EXIV_LENS:              {"Exif.Photo.LensModel"},
+	EXIV_FOCAL_LENGTH:      {"Exif.Photo.FocalLength"},
+	EXIV_FNUMBER:           {"Exif.Photo.FNumber"},
+	EXIV_EXPOSURE:          {"Exif.Photo.ExposureTime"},
+	EXIV_ISO:               {"Exif.Photo.ISOSpeedRatings"},
+	EXIV_DATE:              {"Exif.Photo.DateTimeOriginal"},
+	EXIV_CREATE_DATE:       {"Exif.Photo.DateTimeDigitized"},
 }
 
-// maps the EXIF tag string to the internal enum
-var exivFromName = map[string]int{
-	"Xmp.xmp.Rating":               EXIV_RATING,
-	"Iptc.Application2.Caption":    EXIV_HEADLINE,
-	"Iptc.Application2.Headline":   EXIV_HEADLINE,
-	"Iptc.Application2.ObjectName": EXIV_HEADLINE,
-	"Exif.Image.Orientation":       EXIV_ORIENTATION,
+// maps the internal EXIF enum to the EXIF tag strings.
+// When set, the value is written to all of the tags.
+var exivToSet = map[int][]string{
+	EXIV_RATING:            {"Xmp.xmp.Rating"},
+	EXIV_HEADLINE:          {"Iptc.Application2.Headline", "Xmp.photoshop.Headline"},
+	EXIV_ORIENTATION:       {"Exif.Image.Orientation"},
+	EXIV_LABEL:             {"Xmp.xmp.Label"},
+	EXIV_TITLE:             {"Iptc.Application2.ObjectName", "Xmp.dc.title"},
+	EXIV_DESCRIPTION:       {"Iptc.Application2.Caption", "Xmp.dc.description"},
+	EXIV_KEYWORDS:          {"Xmp.lr.hierarchicalSubject"},
+	EXIV_SUBJECT:           {"Xmp.dc.subject"},
+	EXIV_GPS_LATITUDE:      {"Exif.GPSInfo.GPSLatitude"},
+	EXIV_GPS_LATITUDE_REF:  {"Exif.GPSInfo.GPSLatitudeRef"},
+	EXIV_GPS_LONGITUDE:     {"Exif.GPSInfo.GPSLongitude"},
+	EXIV_GPS_LONGITUDE_REF: {"Exif.GPSInfo.GPSLongitudeRef"},
+	EXIV_GPS_ALTITUDE:      {"Exif.GPSInfo.GPSAltitude"},
+	EXIV_GPS_ALTITUDE_REF:  {"Exif.GPSInfo.GPSAltitudeRef"},
+	EXIV_CITY:              {"Iptc.Application2.City", "Xmp.photoshop.City"},
+	EXIV_STATE:             {"Iptc.Application2.ProvinceState", "Xmp.photoshop.State"},
+	EXIV_COUNTRY:           {"Iptc.Application2.CountryName", "Xmp.photoshop.Country"},
+	EXIV_DATE:              {"Exif.Photo.DateTimeOriginal"},
+	EXIV_CREATE_DATE:       {"Exif.Photo.DateTimeDigitized"},
 }
 
+// maps the EXIF tag string to the internal enum.
+// This is built from exivToGet by initExif.
+var exivFromName map[string]int
+
+// The fields holding the shooting information.
+// These are only read when required, so that loading the
+// images is not slowed down. The dates can be changed, and
+// the changed values are read from the EXIF handler.
+var infoFields = map[int]nothing{
+	EXIV_MAKE: {}, EXIV_MODEL: {}, EXIV_LENS: {}, EXIV_FOCAL_LENGTH: {},
+	EXIV_FNUMBER: {}, EXIV_EXPOSURE: {}, EXIV_ISO: {}, EXIV_DATE: {},
+	EXIV_CREATE_DATE: {},
+}
+
+// XMP tags that are language alternatives.
+var langAltTags = map[string]nothing{
+	"Xmp.dc.title":       {},
+	"Xmp.dc.description": {},
+	"Xmp.dc.rights":      {},
+}
+
+// XMP tags that are unordered lists (bags). exiv2 prints the
+// items separated by a comma and a space.
+var bagTags = map[string]nothing{
+	"Xmp.dc.subject":             {},
+	"Xmp.lr.hierarchicalSubject": {},
+}
+
+const (
+	keyWidth       = 44                           // Width of the tag in the exiv2 output
+	iptcCharsetTag = "Iptc.Envelope.CharacterSet" // IPTC character set
+	iptcUTF8       = "\x1b%G"                     // ISO 2022 escape for UTF-8
+)
+
 // GetExif will create and return the EXIF object for this file
 var GetExif func(string, []byte) (Exif, error)
 
-// Select which EXIF handler should be used.
+// Select which EXIF handler should be used, and build the tag map.
 func initExif() {
+	exivFromName = make(map[string]int)
+	for exiv, tags := range exivToSet {
+		for _, t := range tags {
+			if !contains(exivToGet[exiv], t) {
+				exivToGet[exiv] = append(exivToGet[exiv], t)
+			}
+		}
+	}
+	for exiv, tags := range exivToGet {
+		for _, t := range tags {
+			exivFromName[t] = exiv
+		}
+	}
 	if *sidecar {
 		GetExif = newExivSidecar // Simple EXIF sidecar file
 	} else {
@@ -53,45 +142,210 @@ func initExif() {
 
 // readExif parses lines of the form "<exif-tag> <value>"
 // and returns a map containing the exif data.
-// The exiv2 utility outputs data in this format.
-func readExif(src, lines string) map[int]string {
-	ex := make(map[int]string)
-	for _, l := range strings.Split(lines, "\n") {
-		if len(l) == 0 {
+// The exiv2 utility outputs data in this format, with the tag padded
+// to a fixed width, and a value containing newlines continues on the
+// following lines. If escaped is set, the values have been escaped with
+// valueEscaper so that each line holds one tag, as in the sidecar.
+// If a field is read from more than one tag, the first tag in the
+// read list that has a valid value is used.
+func readExif(src, lines string, escaped bool) map[int]string {
+	values := make(map[string]string)
+	var key string
+	for _, l := range strings.Split(strings.TrimSuffix(lines, "\n"), "\n") {
+		k, v := splitLine(l)
+		// Text within a multi-line value that starts like a tag is
+		// only taken as a new tag if it is padded like one.
+		if !isTag(k) || !(escaped || isTagLine(l, k)) {
+			if len(key) != 0 && !escaped {
+				values[key] += "\n" + l
+			}
 			continue
 		}
-		fields := strings.Fields(l)
-		if len(fields) < 2 {
+		if _, ok := exivFromName[k]; !ok {
+			fmt.Fprintf(os.Stderr, "%s: Unknown exiv tag: %s\n", src, k)
+			key = ""
 			continue
 		}
-		exiv, ok := exivFromName[fields[0]]
-		if ok {
-			// Concatenate values
-			value := strings.Join(fields[1:], " ")
-			switch exiv {
-			case EXIV_HEADLINE:
-				// Create a single string from the separate caption words
-				ex[EXIV_HEADLINE] = value
-			case EXIV_RATING:
-				// Validate rating (should "0" - "5")
-				switch value {
-				default:
-					fmt.Fprintf(os.Stderr, "%s: illegal value for rating (%s)", src, value)
-				case "0", "1", "2", "3", "4", "5":
-					ex[exiv] = value
-				}
-			case EXIV_ORIENTATION:
-				// Validate orientation (should "1" - "8")
-				switch value {
-				default:
-					fmt.Fprintf(os.Stderr, "%s: illegal value for orientation (%s)", src, value)
-				case "1", "2", "3", "4", "5", "6", "7", "8":
+		key = k
+		if escaped {
+			v = valueUnescaper.Replace(v)
+		}
+		values[key] = v
+	}
+	for k, v := range values {
+		// IPTC text that is not valid UTF-8 is most likely Latin-1.
+		// The IPTC character set is not checked.
+		if strings.HasPrefix(k, "Iptc.") && !utf8.ValidString(v) {
+			v = latin1ToUTF8(v)
+		}
+		values[k] = fromTag(k, v)
+	}
+	ex := make(map[int]string)
+	for exiv, tags := range exivToGet {
+		for _, t := range tags {
+			if _, ok := langAltTags[t]; ok {
+				readLangAlt(ex, exiv, values[t])
+				continue
+			}
+			if _, done := ex[exiv]; done {
+				continue
+			}
+			if value, ok := values[t]; ok && len(value) != 0 {
+				if value, ok = validate(src, exiv, value); ok {
 					ex[exiv] = value
 				}
 			}
-		} else {
-			fmt.Fprintf(os.Stderr, "%s: Unknown exiv tag: %s\n", src, fields[0])
 		}
 	}
 	return ex
 }
+
+// readLangAlt adds the values of an XMP language alternative to the
+// field and the fields of the other languages, unless already set by
+// a preferred tag.
+func readLangAlt(ex map[int]string, exiv int, value string) {
+	for lang, v := range parseLangAlt(value) {
+		if len(v) == 0 {
+			continue
+		}
+		f := exiv
+		if lang != defaultLang {
+			if f = langField(exiv, lang); f == exiv {
+				continue
+			}
+		}
+		if _, ok := ex[f]; !ok {
+			ex[f] = v
+		}
+	}
+}
+
+// validate checks the value read for a field.
+func validate(src string, exiv int, value string) (string, bool) {
+	switch exiv {
+	case EXIV_RATING:
+		// Validate rating (should "0" - "5")
+		switch value {
+		default:
+			fmt.Fprintf(os.Stderr, "%s: illegal value for rating (%s)\n", src, value)
+			return "", false
+		case "0", "1", "2", "3", "4", "5":
+			return value, true
+		}
+	case EXIV_ORIENTATION:
+		// Validate orientation (should "1" - "8")
+		switch value {
+		default:
+			fmt.Fprintf(os.Stderr, "%s: illegal value for orientation (%s)\n", src, value)
+			return "", false
+		case "1", "2", "3", "4", "5", "6", "7", "8":
+			return value, true
+		}
+	}
+	// Labels and shooting information are kept as is.
+	return value, true
+}
+
+// splitLine splits a line into the tag and the value. The tag is
+// normally padded to keyWidth, but a single space is also accepted.
+func splitLine(l string) (string, string) {
+	key, rest, _ := strings.Cut(l, " ")
+	pad := keyWidth - len(key)
+	if pad <= 0 {
+		return key, rest
+	}
+	if len(rest) >= pad && len(strings.TrimLeft(rest[:pad], " ")) == 0 {
+		return key, rest[pad:]
+	}
+	return key, strings.TrimLeft(rest, " ")
+}
+
+// isTagLine returns true if the line starts with the tag padded
+// to keyWidth, as output by exiv2.
+func isTagLine(l, key string) bool {
+	pad := max(keyWidth-len(key), 0) + 1
+	return strings.HasPrefix(l[len(key):], strings.Repeat(" ", pad))
+}
+
+// isTag returns true if the string looks like an EXIF tag name.
+func isTag(s string) bool {
+	p := strings.Split(s, ".")
+	return len(p) == 3 && (p[0] == "Exif" || p[0] == "Iptc" || p[0] == "Xmp")
+}
+
+// latin1ToUTF8 converts ISO-8859-1 text to UTF-8.
+func latin1ToUTF8(s string) string {
+	r := make([]rune, len(s))
+	for i := 0; i < len(s); i++ {
+		r[i] = rune(s[i])
+	}
+	return string(r)
+}
+
+// exivQuote quotes a value for an exiv2 modify command, so that spaces
+// and control characters are preserved. XMP language alternatives are
+// always given a language, so that the text cannot be mistaken for
+// a language qualifier.
+func exivQuote(tag, lang, value string) string {
+	if _, ok := langAltTags[tag]; ok {
+		value = fmt.Sprintf("lang=%s %s", lang, value)
+	}
+	return `"` + valueEscaper.Replace(value) + `"`
+}
+
+// writeTags returns the tags written for the field, and the language.
+// Fields in other languages can only be written to XMP language alternatives.
+func writeTags(field int) ([]string, string, bool) {
+	exiv, lang := splitField(field)
+	tags, ok := exivToSet[exiv]
+	if !ok || lang == defaultLang {
+		return tags, lang, ok
+	}
+	var alt []string
+	for _, t := range tags {
+		if _, ok := langAltTags[t]; ok {
+			alt = append(alt, t)
+		}
+	}
+	return alt, lang, len(alt) != 0
+}
+
+// readTags returns the tags to be read for either the shooting
+// information, or the other fields.
+func readTags(info bool) []string {
+	var tags []string
+	for exiv, t := range exivToGet {
+		if _, ok := infoFields[exiv]; ok == info {
+			tags = append(tags, t...)
+		}
+	}
+	sort.Strings(tags)
+	return tags
+}
+
+// valueEscaper escapes the characters in a value that cannot be written
+// as is in a line of the sidecar, or in an exiv2 modify command.
+var valueEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, "\r", `\r`, "\t", `\t`)
+
+// valueUnescaper reverses valueEscaper.
+var valueUnescaper = strings.NewReplacer(`\\`, `\`, `\n`, "\n", `\r`, "\r", `\t`, "\t")
+
+// readInfo reads the shooting information from the image file.
+// The information is always read from the image, regardless of
+// where the other EXIF data is stored.
+func readInfo(file string) map[int]string {
+	cmd := exec.Command("exiv2", "-q", "-P", "EkIXv")
+	for _, t := range readTags(true) {
+		cmd.Args = append(cmd.Args, "-K", t)
+	}
+	cmd.Args = append(cmd.Args, file)
+	outp, err := cmd.Output()
+	if *verbose {
+		fmt.Printf("Running: %s\noutput: %s\n", strings.Join(cmd.Args, " "), outp)
+	}
+	if err != nil && len(outp) == 0 {
+		// No exif in file.
+		return map[int]string{}
+	}
+	return readExif(file, string(outp), false)
+}
@@ -23,36 +23,79 @@ import (
 type exivEmbedded struct {
 	file string
 	exif map[int]string
+	xmp  bool // Only XMP tags are used e.g for an XMP sidecar
 	Exif
 }
 
 func newExivEmbedded(file string, buf []byte) (Exif, error) {
 	e := &exivEmbedded{file: file, exif: map[int]string{}}
-	cmd := exec.Command("exiv2", "-q", "-P", "EkIXv", "-K", "Xmp.xmp.Rating",
-		"-K", "Iptc.Application2.Caption",
-		"-K", "Exif.Image.Orientation",
-		"-K", "Iptc.Application2.Headline",
-		"-K", "Iptc.Application2.ObjectName",
-		file)
+	e.read()
+	return e, nil
+}
+
+// read reads the tags from the file.
+func (e *exivEmbedded) read() {
+	cmd := exec.Command("exiv2", "-q", "-P", "EkIXv")
+	for _, t := range e.filter(readTags(false)) {
+		cmd.Args = append(cmd.Args, "-K", t)
+	}
+	cmd.Args = append(cmd.Args, e.file)
 	outp, err := cmd.Output()
 	if *verbose {
 		fmt.Printf("Running: %s\noutput: %s\n", strings.Join(cmd.Args, " "), outp)
 	}
 	if err != nil {
 		// No exif in file.
-		return e, nil
+		return
 	}
-	e.exif = readExif(e.file, string(outp))
-	return e, nil
+	e.exif = readExif(e.file, string(outp), false)
+}
+
+// filter returns the tags that can be stored in the file.
+func (e *exivEmbedded) filter(tags []string) []string {
+	if !e.xmp {
+		return tags
+	}
+	var xmp []string
+	for _, t := range tags {
+		if strings.HasPrefix(t, "Xmp.") {
+			xmp = append(xmp, t)
+		}
+	}
+	return xmp
 }
 
 func (e *exivEmbedded) Set(tag int, value string) error {
-	etag, ok := exivToSet[tag]
+	etags, lang, ok := writeTags(tag)
 	if !ok {
 		return fmt.Errorf("Unknown EXIF tag: %d", tag)
 	}
+	if etags = e.filter(etags); len(etags) == 0 {
+		return fmt.Errorf("No XMP tag for EXIF tag: %d", tag)
+	}
+	if e.xmp {
+		if err := createXmp(e.file); err != nil {
+			return err
+		}
+	}
 	cmd := exec.Command("exiv2", "-q")
-	cmd.Args = append(cmd.Args, fmt.Sprintf("-Mset %s %s", etag, value))
+	iptc := false
+	for _, etag := range etags {
+		if _, ok := bagTags[etag]; ok {
+			// Each set adds an item to an existing list, so the list is deleted first.
+			cmd.Args = append(cmd.Args, fmt.Sprintf("-Mdel %s", etag))
+			for _, item := range splitList(value) {
+				cmd.Args = append(cmd.Args, fmt.Sprintf("-Mset %s XmpBag %s", etag, exivQuote(etag, lang, item)))
+			}
+			continue
+		}
+		cmd.Args = append(cmd.Args, fmt.Sprintf("-Mset %s %s", etag, exivQuote(etag, lang, toTag(etag, value))))
+		iptc = iptc || strings.HasPrefix(etag, "Iptc.")
+	}
+	if iptc {
+		// Mark the IPTC text as UTF-8
+		cmd.Args = append(cmd.Args, fmt.Sprintf("-Mset %s %s", iptcCharsetTag, exivQuote(iptcCharsetTag, lang, iptcUTF8)))
+	}
 	cmd.Args = append(cmd.Args, e.file)
 	if *verbose {
 		fmt.Printf("Running: %s\n", strings.Join(cmd.Args, " "))
@@ -75,11 +118,20 @@ func (e *exivEmbedded) Delete(tag int) error {
 		// No tag saved
 		return nil
 	}
-	etag, ok := exivToSet[tag]
+	etags, lang, ok := writeTags(tag)
 	if !ok {
 		return fmt.Errorf("Unknown EXIF tag: %d", tag)
 	}
-	cmd := exec.Command("exiv2", "-q", fmt.Sprintf("-Mdel %s", etag), e.file)
+	cmd := exec.Command("exiv2", "-q")
+	for _, etag := range e.filter(etags) {
+		if _, ok := langAltTags[etag]; ok {
+			// Only remove this language, keeping the other languages.
+			cmd.Args = append(cmd.Args, fmt.Sprintf("-Mset %s %s", etag, exivQuote(etag, lang, "")))
+		} else {
+			cmd.Args = append(cmd.Args, fmt.Sprintf("-Mdel %s", etag))
+		}
+	}
+	cmd.Args = append(cmd.Args, e.file)
 	if *verbose {
 		fmt.Printf("Running: %s\n", strings.Join(cmd.Args, " "))
 	}
@@ -89,3 +141,11 @@ func (e *exivEmbedded) Delete(tag int) error {
 	delete(e.exif, tag)
 	return nil
 }
+
+func (e *exivEmbedded) Fields() map[int]string {
+	f := make(map[int]string)
+	for k, v := range e.exif {
+		f[k] = v
+	}
+	return f
+}
@@ -16,11 +16,16 @@ package main
 // The format of the file is:
 // <exif-tag> <value>
 // This is the same format that the exiv2 utility outputs, allowing
-// this handler to use the same parser.
+// this handler to use the same parser. The tag is padded to a fixed
+// width so that values are stored exactly, and newlines, tabs and
+// backslashes in the values are escaped so that each value is on a
+// single line.
 
 import (
 	"fmt"
 	"os"
+	"sort"
+	"strings"
 )
 
 type exivSidecar struct {
@@ -35,13 +40,13 @@ func newExivSidecar(file string, buf []byte) (Exif, error) {
 	e := &exivSidecar{file: f, exif: map[int]string{}}
 	b, err := os.ReadFile(f)
 	if err == nil {
-		e.exif = readExif(f, string(b))
+		e.exif = readExif(f, string(b), true)
 	}
 	return e, nil
 }
 
 func (e *exivSidecar) Set(tag int, value string) error {
-	_, ok := exivToSet[tag]
+	_, _, ok := writeTags(tag)
 	if !ok {
 		return fmt.Errorf("Unknown EXIF tag: %d", tag)
 	}
@@ -59,7 +64,7 @@ func (e *exivSidecar) Delete(tag int) error {
 		// No tag saved
 		return nil
 	}
-	_, ok := exivToSet[tag]
+	_, _, ok := writeTags(tag)
 	if !ok {
 		return fmt.Errorf("Unknown EXIF tag: %d", tag)
 	}
@@ -67,14 +72,44 @@ func (e *exivSidecar) Delete(tag int) error {
 	return e.write()
 }
 
+func (e *exivSidecar) Fields() map[int]string {
+	f := make(map[int]string)
+	for k, v := range e.exif {
+		f[k] = v
+	}
+	return f
+}
+
 func (e *exivSidecar) write() error {
 	f, err := os.Create(e.file)
 	if err != nil {
 		return err
 	}
 	defer f.Close()
+	values := make(map[string]string)
+	alts := make(map[string][]string)
 	for k, v := range e.exif {
-		fmt.Fprintf(f, "%s %s\n", exivToSet[k], v)
+		// Only tags that can be set are saved.
+		if t, lang, ok := writeTags(k); ok {
+			if _, alt := langAltTags[t[0]]; alt {
+				alts[t[0]] = append(alts[t[0]], formatLangAlt(lang, toTag(t[0], v)))
+			} else {
+				values[t[0]] = toTag(t[0], v)
+			}
+		}
+	}
+	// Language alternatives are written in the same form as exiv2 outputs them.
+	for t, l := range alts {
+		sort.Slice(l, func(i, j int) bool { return langOrder(l[i]) < langOrder(l[j]) })
+		values[t] = strings.Join(l, ", ")
+	}
+	var tags []string
+	for t := range values {
+		tags = append(tags, t)
+	}
+	sort.Strings(tags)
+	for _, t := range tags {
+		fmt.Fprintf(f, "%-*s %s\n", keyWidth, t, valueEscaper.Replace(values[t]))
 	}
 	return nil
 }
@@ -0,0 +1,194 @@
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestSidecarRoundTrip checks that values written to the sidecar
+// are read back unchanged.
+func TestSidecarRoundTrip(t *testing.T) {
+	initExif()
+	tests := []struct {
+		name  string
+		value string
+	}{
+		{"plain", "A day at the beach"},
+		{"multi-line", "First line\nSecond line\n\nFourth line"},
+		{"tab", "Column\tcolumn"},
+		{"leading and trailing spaces", "  padded value  "},
+		{"accented", "Café crème à la Bäckerei"},
+		{"CJK", "東京タワーの夜景"},
+		{"backslashes", `C:\new\today \\ \n`},
+		{"unknown tag continuation", "First line\nExif.Photo.Unknown is not a tag"},
+		{"known tag continuation", "First line\nExif.Image.Orientation 6\nXmp.xmp.Rating 5"},
+		{"padded tag continuation", fmt.Sprintf("First line\n%-*s %s", keyWidth, "Xmp.xmp.Rating", "5")},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			file := filepath.Join(t.TempDir(), "image.jpg.exif")
+			e := &exivSidecar{file: file, exif: map[int]string{EXIV_HEADLINE: tc.value, EXIV_RATING: "3"}}
+			if err := e.write(); err != nil {
+				t.Fatalf("write: %v", err)
+			}
+			b, err := os.ReadFile(file)
+			if err != nil {
+				t.Fatalf("read: %v", err)
+			}
+			if n := strings.Count(string(b), "\n"); n != 2 {
+				t.Errorf("sidecar has %d lines, want 2", n)
+			}
+			ex := readExif(file, string(b), true)
+			if got := ex[EXIV_HEADLINE]; got != tc.value {
+				t.Errorf("headline: got %q, want %q", got, tc.value)
+			}
+			if got := ex[EXIV_RATING]; got != "3" {
+				t.Errorf("rating: got %q, want %q", got, "3")
+			}
+			if got, ok := ex[EXIV_ORIENTATION]; ok {
+				t.Errorf("orientation: got %q, want none", got)
+			}
+		})
+	}
+}
+
+// TestReadExifMultiLine checks that a multi-line value in the exiv2
+// output only ends at a line with a tag padded like a tag line.
+func TestReadExifMultiLine(t *testing.T) {
+	initExif()
+	headline := fmt.Sprintf("%-*s %s", keyWidth, "Iptc.Application2.Headline", "First")
+	tests := []struct {
+		name   string
+		lines  []string
+		want   string
+		rating string
+	}{
+		{"continuation", []string{headline, "Second", "", "Fourth"}, "First\nSecond\n\nFourth", ""},
+		{"unknown tag", []string{headline, "Second", fmt.Sprintf("%-*s %s", keyWidth, "Exif.Photo.Unknown", "value")}, "First\nSecond", ""},
+		{"unpadded unknown tag", []string{headline, "Exif.Photo.Unknown value"}, "First\nExif.Photo.Unknown value", ""},
+		{"unpadded known tag", []string{headline, "Xmp.xmp.Rating 5"}, "First\nXmp.xmp.Rating 5", ""},
+		{"padded known tag", []string{headline, fmt.Sprintf("%-*s %s", keyWidth, "Xmp.xmp.Rating", "5")}, "First", "5"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			ex := readExif("test", strings.Join(tc.lines, "\n")+"\n", false)
+			if got := ex[EXIV_HEADLINE]; got != tc.want {
+				t.Errorf("headline: got %q, want %q", got, tc.want)
+			}
+			if got := ex[EXIV_RATING]; got != tc.rating {
+				t.Errorf("rating: got %q, want %q", got, tc.rating)
+			}
+		})
+	}
+}
+
+// TestReadSidecarLegacy checks that a sidecar written with a single
+// space after the tag is still read.
+func TestReadSidecarLegacy(t *testing.T) {
+	initExif()
+	ex := readExif("test", "Iptc.Application2.Headline A caption\nXmp.xmp.Rating 4\n", true)
+	if got, want := ex[EXIV_HEADLINE], "A caption"; got != want {
+		t.Errorf("headline: got %q, want %q", got, want)
+	}
+	if got, want := ex[EXIV_RATING], "4"; got != want {
+		t.Errorf("rating: got %q, want %q", got, want)
+	}
+}
+
+func TestSplitLine(t *testing.T) {
+	long := "Xmp.example.aVeryLongTagNameThatIsWiderThanTheKeyWidth"
+	tests := []struct {
+		name  string
+		line  string
+		key   string
+		value string
+	}{
+		{"padded", fmt.Sprintf("%-*s %s", keyWidth, "Exif.Image.Orientation", "6"), "Exif.Image.Orientation", "6"},
+		{"padded with leading spaces", fmt.Sprintf("%-*s %s", keyWidth, "Iptc.Application2.Headline", "  text  "), "Iptc.Application2.Headline", "  text  "},
+		{"padded empty", fmt.Sprintf("%-*s %s", keyWidth, "Iptc.Application2.Headline", ""), "Iptc.Application2.Headline", ""},
+		{"legacy", "Exif.Image.Orientation 6", "Exif.Image.Orientation", "6"},
+		{"legacy extra spaces", "Iptc.Application2.Headline   some text", "Iptc.Application2.Headline", "some text"},
+		{"long key", long + " value", long, "value"},
+		{"no value", "Exif.Image.Orientation", "Exif.Image.Orientation", ""},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			k, v := splitLine(tc.line)
+			if k != tc.key || v != tc.value {
+				t.Errorf("splitLine(%q) = %q, %q, want %q, %q", tc.line, k, v, tc.key, tc.value)
+			}
+		})
+	}
+}
+
+func TestLatin1ToUTF8(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"plain", "plain"},
+		{"caf\xe9", "café"},
+		{"\xa9 2020 M\xfcller", "© 2020 Müller"},
+		{"", ""},
+	}
+	for _, tc := range tests {
+		if got := latin1ToUTF8(tc.in); got != tc.want {
+			t.Errorf("latin1ToUTF8(%q) = %q, want %q", tc.in, got, tc.want)
+		}
+	}
+}
+
+// TestReadExifLatin1 checks that IPTC text that is not valid UTF-8 is
+// read as Latin-1, and that valid UTF-8 is unchanged.
+func TestReadExifLatin1(t *testing.T) {
+	initExif()
+	tests := []struct {
+		value, want string
+	}{
+		{"Caf\xe9 cr\xe8me", "Café crème"},
+		{"Café crème", "Café crème"},
+	}
+	for _, tc := range tests {
+		ex := readExif("test", fmt.Sprintf("%-*s %s\n", keyWidth, "Iptc.Application2.Headline", tc.value), false)
+		if got := ex[EXIV_HEADLINE]; got != tc.want {
+			t.Errorf("%q: got %q, want %q", tc.value, got, tc.want)
+		}
+	}
+}
+
+func TestExivQuote(t *testing.T) {
+	tests := []struct {
+		tag, lang, value, want string
+	}{
+		{"Iptc.Application2.Headline", defaultLang, "plain text", `"plain text"`},
+		{"Iptc.Application2.Headline", defaultLang, "a\\b", `"a\\b"`},
+		{"Iptc.Application2.Headline", defaultLang, "one\ntwo\r\n", `"one\ntwo\r\n"`},
+		{"Iptc.Application2.Headline", defaultLang, "a\tb", `"a\tb"`},
+		{"Iptc.Application2.Headline", defaultLang, "  spaces  ", `"  spaces  "`},
+		{"Xmp.dc.title", defaultLang, "Title", `"lang=x-default Title"`},
+		{"Xmp.dc.title", "de", "lang=en text", `"lang=de lang=en text"`},
+	}
+	for _, tc := range tests {
+		if got := exivQuote(tc.tag, tc.lang, tc.value); got != tc.want {
+			t.Errorf("exivQuote(%q, %q, %q) = %s, want %s", tc.tag, tc.lang, tc.value, got, tc.want)
+		}
+	}
+	// Quoted values have no raw control characters.
+	if q := exivQuote("Iptc.Application2.Headline", defaultLang, "a\nb\tc"); strings.ContainsAny(q, "\n\t") {
+		t.Errorf("control characters not escaped: %q", q)
+	}
+}
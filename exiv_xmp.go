@@ -0,0 +1,57 @@
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+// Support XMP sidecar files, as written by other applications.
+// The XMP file is read and written using exiv2 in the same way as
+// embedded EXIF data, but only the XMP tags are used. The sidecar is
+// either <image>.xmp or <base name>.xmp, and new sidecars use the
+// base name.
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// An empty XMP packet, used to create a new sidecar.
+const emptyXmp = `<?xpacket begin="` + "\ufeff" + `" id="W5M0MpCehiHzreSzNTczkc9d"?>
+<x:xmpmeta xmlns:x="adobe:ns:meta/">
+ <rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#"/>
+</x:xmpmeta>
+<?xpacket end="w"?>
+`
+
+// xmpPath returns the XMP sidecar of the image.
+func xmpPath(file string) string {
+	if _, err := os.Stat(file + ".xmp"); err == nil {
+		return file + ".xmp"
+	}
+	return strings.TrimSuffix(file, filepath.Ext(file)) + ".xmp"
+}
+
+func newExivXmp(file string, buf []byte) (Exif, error) {
+	e := &exivEmbedded{file: xmpPath(file), exif: map[int]string{}, xmp: true}
+	if _, err := os.Stat(e.file); err == nil {
+		e.read()
+	}
+	return e, nil
+}
+
+// createXmp creates an empty XMP sidecar if it does not exist.
+func createXmp(file string) error {
+	if _, err := os.Stat(file); err == nil {
+		return nil
+	}
+	return os.WriteFile(file, []byte(emptyXmp), 0644)
+}
@@ -0,0 +1,221 @@
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+// Exporting images as resized JPEGs e.g for the web.
+// The orientation is applied to the pixels, and the file name is
+// expanded from a caption template. The metadata embedded in the image
+// is either copied or removed; metadata in sidecar files is not copied.
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+	"github.com/davidbyttow/govips/v2/vips"
+)
+
+// defaultExport returns the export options set by the flags.
+func defaultExport() exportOptions {
+	return exportOptions{
+		dir:     *exportDir,
+		name:    *exportName,
+		size:    *exportSize,
+		quality: *exportQuality,
+		strip:   *exportStrip,
+	}
+}
+
+// path returns the file that the image is exported to.
+func (o exportOptions) path(p *Pict, seq int) string {
+	name := safeName(expandTemplate(o.name, p, seq))
+	if len(name) == 0 {
+		name = strings.TrimSuffix(p.Name(), filepath.Ext(p.Name()))
+	}
+	return filepath.Join(targetDir(p, o.dir), name+".jpg")
+}
+
+// safeName replaces the characters that cannot be used in a file name on
+// common file systems (e.g the : in a {time}) with an underscore.
+// Windows also does not allow a name to end with a space or a dot.
+func safeName(name string) string {
+	name = strings.Map(func(r rune) rune {
+		if r < ' ' || strings.ContainsRune(`/\:*?"<>|`, r) {
+			return '_'
+		}
+		return r
+	}, name)
+	return strings.TrimRight(name, " .")
+}
+
+// exportPaths returns the file that each image is exported to, numbering
+// the images in order. The names are reserved before any image is written,
+// so that images with the same name are given a numeric suffix rather
+// than overwriting each other.
+func exportPaths(picts []*Pict, o exportOptions) map[*Pict]string {
+	paths := make(map[*Pict]string)
+	used := make(map[string]bool)
+	for i, p := range picts {
+		out := o.path(p, i+1)
+		base := strings.TrimSuffix(out, ".jpg")
+		// Names are compared ignoring case, for case insensitive file systems.
+		for n := 2; used[strings.ToLower(filepath.Clean(out))]; n++ {
+			out = fmt.Sprintf("%s-%d.jpg", base, n)
+		}
+		used[strings.ToLower(filepath.Clean(out))] = true
+		paths[p] = out
+	}
+	return paths
+}
+
+// exportImage writes the image as a JPEG to out, returning the file written.
+func exportImage(p *Pict, o exportOptions, out string) (string, error) {
+	if abs, err := filepath.Abs(p.Path()); err == nil {
+		if absOut, err := filepath.Abs(out); err == nil && abs == absOut {
+			return "", fmt.Errorf("%s: would overwrite the image", out)
+		}
+	}
+	// The orientation may be in a sidecar file.
+	if err := p.ready(); err != nil {
+		return "", err
+	}
+	vimg, err := vips.NewImageFromFile(p.Path())
+	if err != nil {
+		return "", err
+	}
+	defer vimg.Close()
+	p.orient(vimg)
+	// The copied metadata must not rotate the image again.
+	if err := vimg.RemoveOrientation(); err != nil {
+		return "", err
+	}
+	if o.size > 0 {
+		if scale := float64(o.size) / float64(max(vimg.Width(), vimg.Height())); scale < 1 {
+			if err := vimg.Resize(scale, vips.KernelAuto); err != nil {
+				return "", err
+			}
+		}
+	}
+	params := vips.NewJpegExportParams()
+	params.Quality = o.quality
+	params.StripMetadata = o.strip
+	buf, _, err := vimg.ExportJpeg(params)
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(filepath.Dir(out), 0755); err != nil {
+		return "", err
+	}
+	return out, os.WriteFile(out, buf, 0644)
+}
+
+// ratedPicts returns the images with at least the rating,
+// or all the images if the rating is negative.
+func ratedPicts(files []string, rating int) []*Pict {
+	var picts []*Pict
+	f := ratingFilter(rating)
+	for i, file := range files {
+		p := NewPict(file, i)
+		if rating < 0 || f.match(p) {
+			picts = append(picts, p)
+		}
+	}
+	return picts
+}
+
+// exportCmd exports the images on the command line.
+func exportCmd(args []string) error {
+	o := defaultExport()
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	fs.StringVar(&o.dir, "o", o.dir, "Output directory, relative to the image directory")
+	fs.StringVar(&o.name, "name", o.name, "Template for the output file names")
+	fs.IntVar(&o.size, "size", o.size, "Maximum width or height, 0 for the original size")
+	fs.IntVar(&o.quality, "quality", o.quality, "JPEG quality")
+	fs.BoolVar(&o.strip, "strip", o.strip, "Remove the metadata")
+	rating := fs.Int("rating", -1, "Only export images with at least this rating")
+	fs.Parse(args)
+	files := expand(fs.Args())
+	if len(files) == 0 {
+		return fmt.Errorf("no images")
+	}
+	picts := ratedPicts(files, *rating)
+	if len(picts) == 0 {
+		return fmt.Errorf("no images with a rating of at least %d", *rating)
+	}
+	paths := exportPaths(picts, o)
+	failed := runCmd(picts, func(p *Pict) (string, error) {
+		out, err := exportImage(p, o, paths[p])
+		return fmt.Sprintf("%s -> %s", p.Path(), out), err
+	})
+	if failed != 0 {
+		return fmt.Errorf("%d images failed", failed)
+	}
+	return nil
+}
+
+// export asks for the export options, and exports the marked images.
+func (a *Ptag) export() {
+	m := a.marked()
+	if len(m) == 0 {
+		a.setStatus("No images marked")
+		return
+	}
+	dir := widget.NewEntry()
+	dir.SetText(*exportDir)
+	name := widget.NewEntry()
+	name.SetText(*exportName)
+	size := widget.NewEntry()
+	size.SetText(strconv.Itoa(*exportSize))
+	quality := widget.NewEntry()
+	quality.SetText(strconv.Itoa(*exportQuality))
+	strip := widget.NewCheck("", nil)
+	strip.SetChecked(*exportStrip)
+	items := []*widget.FormItem{
+		widget.NewFormItem("Directory", dir),
+		widget.NewFormItem("Name", name),
+		widget.NewFormItem("Size", size),
+		widget.NewFormItem("Quality", quality),
+		widget.NewFormItem("Strip metadata", strip),
+	}
+	dialog.ShowForm(fmt.Sprintf("Export %d marked images", len(m)), "Export", "Cancel", items, func(ok bool) {
+		a.lock.Lock()
+		defer a.lock.Unlock()
+		if !ok {
+			return
+		}
+		sz, err1 := strconv.Atoi(size.Text)
+		q, err2 := strconv.Atoi(quality.Text)
+		if err1 != nil || err2 != nil || sz < 0 || q < 1 || q > 100 {
+			a.setStatus("Illegal size or quality")
+			return
+		}
+		// The options are kept for the next export.
+		*exportDir, *exportName, *exportSize, *exportQuality, *exportStrip = dir.Text, name.Text, sz, q, strip.Checked
+		o := defaultExport()
+		// The names are expanded from the EXIF data, so they are reserved
+		// in the background by the first worker, before any image is written.
+		var once sync.Once
+		var paths map[*Pict]string
+		a.runBatch("Export", m, false, func(p *Pict) error {
+			once.Do(func() { paths = exportPaths(m, o) })
+			_, err := exportImage(p, o, paths[p])
+			return err
+		}, nil)
+	}, a.win)
+}
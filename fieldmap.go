@@ -0,0 +1,156 @@
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+// Configuration of the EXIF tags used for each field.
+// The field map file replaces the default tags that are read or
+// written for a field. Each line is of the form:
+//
+//	<field> read <tag> [<tag> ...]
+//	<field> write <tag> [<tag> ...]
+//
+// When reading, the first tag in the list with a value is used.
+// When writing, the value is written to all of the tags.
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// The names of the fields that can be mapped in the field map file.
+var fieldNames = map[string]int{
+	"rating":      EXIV_RATING,
+	"headline":    EXIV_HEADLINE,
+	"orientation": EXIV_ORIENTATION,
+	"label":       EXIV_LABEL,
+	"title":       EXIV_TITLE,
+	"description": EXIV_DESCRIPTION,
+	"keywords":    EXIV_KEYWORDS,
+	"subject":     EXIV_SUBJECT,
+	"city":        EXIV_CITY,
+	"state":       EXIV_STATE,
+	"country":     EXIV_COUNTRY,
+}
+
+// Tags whose values are stored in a different form to the field value.
+var tagConvert = map[string]struct{ read, write func(string) string }{
+	"Exif.Image.RatingPercent": {percentToRating, ratingToPercent},
+}
+
+// readFieldMap reads the field map file, replacing the default tags.
+// Blank lines and lines starting with '#' are ignored.
+func readFieldMap(file string) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	line := 0
+	for scanner.Scan() {
+		line++
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		if len(fields) < 3 {
+			return fmt.Errorf("%s:%d: expected <field> read|write <tag> ...", file, line)
+		}
+		exiv, ok := fieldNames[fields[0]]
+		if !ok {
+			return fmt.Errorf("%s:%d: unknown field (%s)", file, line, fields[0])
+		}
+		for _, t := range fields[2:] {
+			if p := strings.Split(t, "."); len(p) != 3 || (p[0] != "Exif" && p[0] != "Iptc" && p[0] != "Xmp") {
+				return fmt.Errorf("%s:%d: illegal tag (%s)", file, line, t)
+			}
+		}
+		switch fields[1] {
+		case "read":
+			exivToGet[exiv] = fields[2:]
+		case "write":
+			exivToSet[exiv] = fields[2:]
+		default:
+			return fmt.Errorf("%s:%d: expected read or write (%s)", file, line, fields[1])
+		}
+	}
+	return scanner.Err()
+}
+
+// contains returns true if the tag is in the list.
+func contains(tags []string, tag string) bool {
+	for _, t := range tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// fromTag converts a value read from a tag to the field value.
+func fromTag(tag, value string) string {
+	if c, ok := tagConvert[tag]; ok {
+		return c.read(value)
+	}
+	return value
+}
+
+// toTag converts a field value to the value written to a tag.
+func toTag(tag, value string) string {
+	if c, ok := tagConvert[tag]; ok {
+		return c.write(value)
+	}
+	return value
+}
+
+// percentToRating converts a rating percentage to a rating,
+// using the same ranges as Windows when reading the rating.
+func percentToRating(value string) string {
+	p, err := strconv.Atoi(value)
+	if err != nil {
+		return value
+	}
+	switch {
+	case p <= 0:
+		return "0"
+	case p <= 12:
+		return "1"
+	case p <= 37:
+		return "2"
+	case p <= 62:
+		return "3"
+	case p <= 87:
+		return "4"
+	}
+	return "5"
+}
+
+// ratingToPercent converts a rating to a rating percentage.
+func ratingToPercent(value string) string {
+	switch value {
+	case "1":
+		return "1"
+	case "2":
+		return "25"
+	case "3":
+		return "50"
+	case "4":
+		return "75"
+	case "5":
+		return "99"
+	}
+	return "0"
+}
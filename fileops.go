@@ -0,0 +1,236 @@
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+// File operations for moving, copying and trashing images
+// along with their associated files.
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Extensions of files that are associated with an image of the same base name.
+var companionExt = map[string]nothing{
+	".xmp": {},
+	".cr2": {}, ".cr3": {}, ".crw": {}, ".nef": {}, ".nrw": {}, ".arw": {},
+	".srf": {}, ".sr2": {}, ".dng": {}, ".raf": {}, ".orf": {}, ".rw2": {},
+	".pef": {}, ".srw": {}, ".x3f": {}, ".raw": {},
+}
+
+// companions returns the image file and its associated files, such as the
+// EXIF sidecar, and any RAW or XMP files with the same base name.
+func companions(file string) []string {
+	files := []string{file}
+	if _, err := os.Stat(file + ".exif"); err == nil {
+		files = append(files, file+".exif")
+	}
+	if _, err := os.Stat(file + ".xmp"); err == nil {
+		files = append(files, file+".xmp")
+	}
+	dir, name := filepath.Split(file)
+	base := strings.TrimSuffix(name, filepath.Ext(name))
+	entries, err := os.ReadDir(filepath.Clean(dir + "."))
+	if err != nil {
+		return files
+	}
+	for _, e := range entries {
+		n := e.Name()
+		if e.IsDir() || n == name || strings.TrimSuffix(n, filepath.Ext(n)) != base {
+			continue
+		}
+		if _, ok := companionExt[strings.ToLower(filepath.Ext(n))]; ok {
+			files = append(files, filepath.Join(dir, n))
+		}
+	}
+	return files
+}
+
+// uniquePath returns a path that does not already exist, by adding
+// a number to the file name if necessary.
+func uniquePath(file string) string {
+	ext := filepath.Ext(file)
+	base := strings.TrimSuffix(file, ext)
+	for i := 1; ; i++ {
+		if _, err := os.Lstat(file); errors.Is(err, os.ErrNotExist) {
+			return file
+		}
+		file = fmt.Sprintf("%s-%d%s", base, i, ext)
+	}
+}
+
+// moveFile renames a file, copying it if it is being moved to another filesystem.
+func moveFile(from, to string) error {
+	err := os.Rename(from, to)
+	if err == nil || !errors.Is(err, syscall.EXDEV) {
+		return err
+	}
+	if err := copyFile(from, to); err != nil {
+		return err
+	}
+	return os.Remove(from)
+}
+
+// copyFile copies a file, preserving the modification time.
+func copyFile(from, to string) error {
+	src, err := os.Open(from)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	st, err := src.Stat()
+	if err != nil {
+		return err
+	}
+	dst, err := os.OpenFile(to, os.O_WRONLY|os.O_CREATE|os.O_EXCL, st.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(dst, src); err != nil {
+		dst.Close()
+		os.Remove(to)
+		return err
+	}
+	if err := dst.Close(); err != nil {
+		os.Remove(to)
+		return err
+	}
+	return os.Chtimes(to, st.ModTime(), st.ModTime())
+}
+
+// transfer moves or copies the files to the directory, which is created
+// if necessary. The list of files transferred is returned.
+// If an error occurs, any files already moved are moved back.
+func transfer(files []string, dir string, move bool) ([]moved, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	var done []moved
+	for _, f := range files {
+		to := uniquePath(filepath.Join(dir, filepath.Base(f)))
+		var err error
+		if move {
+			err = moveFile(f, to)
+		} else {
+			err = copyFile(f, to)
+		}
+		if err != nil {
+			revert(done, move)
+			return nil, err
+		}
+		done = append(done, moved{f, to})
+	}
+	return done, nil
+}
+
+// revert undoes a transfer by moving the files back, or removing the copies.
+func revert(files []moved, move bool) error {
+	var err error
+	for _, m := range files {
+		var e error
+		if move {
+			e = moveFile(m.to, m.from)
+		} else {
+			e = os.Remove(m.to)
+		}
+		if e != nil {
+			err = e
+		}
+	}
+	return err
+}
+
+// trashDir returns the freedesktop.org home trash directory.
+func trashDir() (string, error) {
+	data := os.Getenv("XDG_DATA_HOME")
+	if len(data) == 0 {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		data = filepath.Join(home, ".local", "share")
+	}
+	return filepath.Join(data, "Trash"), nil
+}
+
+// trashFiles moves the files to the trash as described by the
+// freedesktop.org trash specification.
+// The list of files trashed is returned. The trash info files
+// are named by appending ".trashinfo" to the destination name.
+func trashFiles(files []string) ([]moved, error) {
+	trash, err := trashDir()
+	if err != nil {
+		return nil, err
+	}
+	filesDir := filepath.Join(trash, "files")
+	infoDir := filepath.Join(trash, "info")
+	for _, d := range []string{filesDir, infoDir} {
+		if err := os.MkdirAll(d, 0700); err != nil {
+			return nil, err
+		}
+	}
+	var done []moved
+	for _, f := range files {
+		abs, err := filepath.Abs(f)
+		if err != nil {
+			untrash(done)
+			return nil, err
+		}
+		// The info file is created first to reserve the name.
+		var info *os.File
+		var name string
+		for i := 0; ; i++ {
+			name = filepath.Base(f)
+			if i != 0 {
+				ext := filepath.Ext(name)
+				name = fmt.Sprintf("%s-%d%s", strings.TrimSuffix(name, ext), i, ext)
+			}
+			info, err = os.OpenFile(filepath.Join(infoDir, name+".trashinfo"), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+			if err == nil || !errors.Is(err, os.ErrExist) {
+				break
+			}
+		}
+		if err != nil {
+			untrash(done)
+			return nil, err
+		}
+		u := url.URL{Path: abs}
+		fmt.Fprintf(info, "[Trash Info]\nPath=%s\nDeletionDate=%s\n", u.EscapedPath(), time.Now().Format("2006-01-02T15:04:05"))
+		info.Close()
+		to := filepath.Join(filesDir, name)
+		if err := moveFile(f, to); err != nil {
+			os.Remove(info.Name())
+			untrash(done)
+			return nil, err
+		}
+		done = append(done, moved{f, to})
+	}
+	return done, nil
+}
+
+// untrash restores files from the trash.
+func untrash(files []moved) error {
+	err := revert(files, true)
+	for _, m := range files {
+		infoFile := filepath.Join(filepath.Dir(filepath.Dir(m.to)), "info", filepath.Base(m.to)+".trashinfo")
+		os.Remove(infoFile)
+	}
+	return err
+}
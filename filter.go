@@ -0,0 +1,160 @@
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+// Filters select the subset of images that are displayed.
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"sync"
+	"sync/atomic"
+
+	"github.com/davidbyttow/govips/v2/vips"
+)
+
+// ratingFilter selects images with a rating of at least min.
+func ratingFilter(min int) *filter {
+	return &filter{fmt.Sprintf("rating >= %d", min), func(p *Pict) bool {
+		r, err := p.Rating()
+		return err == nil && r >= min
+	}}
+}
+
+// unratedFilter selects images without a rating.
+func unratedFilter() *filter {
+	return &filter{"unrated", func(p *Pict) bool {
+		r, err := p.Rating()
+		return err == nil && r < 0
+	}}
+}
+
+// setFilter selects the images to be displayed. A nil filter selects all images.
+// The EXIF data of all the images is read in the background so that they
+// can be matched, and the filter is applied when the scan is complete.
+func (a *Ptag) setFilter(f *filter) {
+	if f == nil {
+		a.applyFilter(nil)
+		return
+	}
+	a.runBatch("Filter: "+f.name, a.all, false, func(p *Pict) error {
+		// Images that cannot be read are not matched.
+		p.ready()
+		return nil
+	}, func() { a.applyFilter(f) })
+}
+
+// applyFilter displays the images selected by the filter.
+// The EXIF data used by the filter must already have been read.
+func (a *Ptag) applyFilter(f *filter) {
+	a.Sync()
+	var picts []*Pict
+	if f == nil {
+		picts = a.all
+	} else {
+		for _, p := range a.all {
+			if f.match(p) {
+				picts = append(picts, p)
+			}
+		}
+		if len(picts) == 0 {
+			fmt.Fprintf(os.Stderr, "No images match filter: %s\n", f.name)
+			return
+		}
+	}
+	if a.stacks != nil {
+		picts = a.stacks.view(picts)
+	}
+	// Try to keep the current image (or its stack), or the next one that matches.
+	current := a.picts[a.index]
+	newIndex := len(picts) - 1
+	for i, p := range picts {
+		if p == current || a.stacks.same(p, current) || p.seq > current.seq {
+			newIndex = i
+			break
+		}
+	}
+	a.stopCompare()
+	if *verbose {
+		fmt.Printf("Filter selects %d of %d images\n", len(picts), len(a.all))
+	}
+	a.flushCache()
+	a.filter = f
+	a.picts = picts
+	a.retitle()
+	a.setIndex(newIndex)
+}
+
+// retitle sets the window titles and indices of the displayed images.
+func (a *Ptag) retitle() {
+	suffix := ""
+	if a.filter != nil {
+		suffix = fmt.Sprintf(" [%s]", a.filter.name)
+	}
+	for i, p := range a.picts {
+		p.index = i
+		p.SetTitle(fmt.Sprintf("%s (%d/%d)%s%s", p.Path(), i+1, len(a.picts), suffix, a.stacks.label(p)))
+	}
+}
+
+// forAll runs the function on every image, using up to the preload count
+// of goroutines, and waits for them to complete.
+func (a *Ptag) forAll(picts []*Pict, f func(*Pict)) {
+	parallel(picts, a.preload, f)
+}
+
+// parallel runs the function on every image using n goroutines
+// (at least one), and waits for them to complete.
+func parallel(picts []*Pict, n int, f func(*Pict)) {
+	var wg sync.WaitGroup
+	ch := make(chan *Pict)
+	for i := 0; i < max(n, 1); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for p := range ch {
+				f(p)
+			}
+		}()
+	}
+	for _, p := range picts {
+		ch <- p
+	}
+	close(ch)
+	wg.Wait()
+}
+
+// runCmd runs the operation on the images of a command, using a goroutine
+// for each CPU. The progress is printed with the message returned by the
+// operation, unless it is empty, and the errors are reported.
+// The number of images that failed is returned.
+func runCmd(picts []*Pict, op func(*Pict) (string, error)) int {
+	vips.LoggingSettings(nil, vips.LogLevelError)
+	vips.Startup(nil)
+	defer vips.Shutdown()
+	var count, failed int32
+	parallel(picts, runtime.NumCPU(), func(p *Pict) {
+		msg, err := op(p)
+		n := atomic.AddInt32(&count, 1)
+		if err != nil {
+			atomic.AddInt32(&failed, 1)
+			fmt.Fprintf(os.Stderr, "%s: %v\n", p.Path(), err)
+			return
+		}
+		if len(msg) != 0 {
+			fmt.Printf("[%d/%d] %s\n", n, len(picts), msg)
+		}
+	})
+	return int(failed)
+}
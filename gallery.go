@@ -0,0 +1,216 @@
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+// Static HTML galleries.
+// A gallery is a directory holding index.html, and the images and
+// thumbnails exported as JPEGs in the images and thumbs directories.
+// The page has no external dependencies, so the directory can be
+// copied anywhere or shared as an archive.
+
+import (
+	"flag"
+	"fmt"
+	"html/template"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/dialog"
+)
+
+// Default maximum width or height of gallery thumbnails.
+const thumbSize = 320
+
+// Name of the gallery files, so that they sort in gallery order.
+const galleryName = "{seq}_{name}"
+
+var galleryPage = template.Must(template.New("gallery").Funcs(template.FuncMap{
+	"stars": func(r int) string { return strings.Repeat("★", r) + strings.Repeat("☆", 5-r) },
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{.Title}}</title>
+<style>
+body { background: #222; color: #ddd; font-family: sans-serif; margin: 1em; }
+h1 { font-weight: normal; }
+.grid { display: flex; flex-wrap: wrap; gap: 1em; }
+figure { margin: 0; width: {{.Size}}px; }
+figure img { max-width: 100%; max-height: {{.Size}}px; display: block; margin: auto; }
+figcaption { font-size: small; padding-top: 0.3em; }
+.rating { color: #fc3; }
+.view { display: none; position: fixed; inset: 0; background: #000e; text-align: center; }
+.view:target { display: block; }
+.view img { max-width: 95vw; max-height: 88vh; margin-top: 2vh; }
+.view a { color: #ddd; text-decoration: none; }
+</style>
+</head>
+<body>
+<h1>{{.Title}}</h1>
+<div class="grid">
+{{- range $i, $p := .Items}}
+<figure>
+<a href="#v{{$i}}"><img src="{{$p.Thumb}}" alt="{{$p.Name}}" loading="lazy"></a>
+<figcaption>{{$p.Name}}{{if ge $p.Rating 0}} <span class="rating">{{stars $p.Rating}}</span>{{end}}{{if $p.Caption}}<br>{{$p.Caption}}{{end}}</figcaption>
+</figure>
+{{- end}}
+</div>
+{{- range $i, $p := .Items}}
+<div class="view" id="v{{$i}}">
+<a href="#"><img src="{{$p.Image}}" alt="{{$p.Name}}"></a>
+<p>{{if $p.Caption}}{{$p.Caption}} &middot; {{end}}<a href="{{$p.Image}}">{{$p.Name}}</a></p>
+</div>
+{{- end}}
+</body>
+</html>
+`))
+
+// galleryImage exports the image and its thumbnail to the gallery directory.
+func galleryImage(p *Pict, dir string, o exportOptions, seq int) (galleryItem, error) {
+	var item galleryItem
+	full := o
+	full.dir, full.name = filepath.Join(dir, "images"), galleryName
+	out, err := exportImage(p, full, full.path(p, seq))
+	if err != nil {
+		return item, err
+	}
+	thumb := full
+	thumb.dir, thumb.size = filepath.Join(dir, "thumbs"), thumbSize
+	tOut, err := exportImage(p, thumb, thumb.path(p, seq))
+	if err != nil {
+		return item, err
+	}
+	item.Image = filepath.ToSlash(filepath.Join("images", filepath.Base(out)))
+	item.Thumb = filepath.ToSlash(filepath.Join("thumbs", filepath.Base(tOut)))
+	item.Name = p.Name()
+	item.seq = seq
+	item.Caption, _ = p.Field(EXIV_HEADLINE)
+	if item.Rating, err = p.Rating(); err != nil {
+		item.Rating = -1
+	}
+	return item, nil
+}
+
+// writeGallery writes the gallery page for the exported images.
+func writeGallery(dir, title string, items []galleryItem) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	sort.Slice(items, func(i, j int) bool { return items[i].seq < items[j].seq })
+	f, err := os.Create(filepath.Join(dir, "index.html"))
+	if err != nil {
+		return err
+	}
+	err = galleryPage.Execute(f, struct {
+		Title string
+		Size  int
+		Items []galleryItem
+	}{title, thumbSize, items})
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// galleryCmd builds a gallery from the images on the command line.
+func galleryCmd(args []string) error {
+	o := defaultExport()
+	fs := flag.NewFlagSet("gallery", flag.ExitOnError)
+	dir := fs.String("o", "gallery", "Gallery directory")
+	title := fs.String("title", "", "Title of the gallery page (default is the directory name)")
+	fs.IntVar(&o.size, "size", o.size, "Maximum width or height of the images, 0 for the original size")
+	fs.IntVar(&o.quality, "quality", o.quality, "JPEG quality")
+	fs.BoolVar(&o.strip, "strip", o.strip, "Remove the metadata")
+	rating := fs.Int("rating", -1, "Only include images with at least this rating")
+	fs.Parse(args)
+	files := expand(fs.Args())
+	if len(files) == 0 {
+		return fmt.Errorf("no images")
+	}
+	picts := ratedPicts(files, *rating)
+	if len(picts) == 0 {
+		return fmt.Errorf("no images with a rating of at least %d", *rating)
+	}
+	if len(*title) == 0 {
+		*title = filepath.Base(*dir)
+	}
+	out, err := filepath.Abs(*dir)
+	if err != nil {
+		return err
+	}
+	seq := make(map[*Pict]int)
+	for i, p := range picts {
+		seq[p] = i + 1
+	}
+	var lock sync.Mutex
+	var items []galleryItem
+	failed := runCmd(picts, func(p *Pict) (string, error) {
+		item, err := galleryImage(p, out, o, seq[p])
+		if err != nil {
+			return "", err
+		}
+		lock.Lock()
+		items = append(items, item)
+		lock.Unlock()
+		return p.Path(), nil
+	})
+	if err := writeGallery(out, *title, items); err != nil {
+		return err
+	}
+	if failed != 0 {
+		return fmt.Errorf("%d images failed", failed)
+	}
+	fmt.Printf("Gallery written to %s\n", filepath.Join(*dir, "index.html"))
+	return nil
+}
+
+// gallery builds a gallery from the displayed images, in a selected directory.
+func (a *Ptag) gallery() {
+	picts := a.picts
+	dialog.ShowFolderOpen(func(d fyne.ListableURI, err error) {
+		a.lock.Lock()
+		defer a.lock.Unlock()
+		if err != nil || d == nil {
+			return
+		}
+		dir := d.Path()
+		o := defaultExport()
+		seq := make(map[*Pict]int)
+		for i, p := range picts {
+			seq[p] = i + 1
+		}
+		var lock sync.Mutex
+		var items []galleryItem
+		a.runBatch("Gallery", picts, false, func(p *Pict) error {
+			item, err := galleryImage(p, dir, o, seq[p])
+			if err != nil {
+				return err
+			}
+			lock.Lock()
+			items = append(items, item)
+			lock.Unlock()
+			return nil
+		}, func() {
+			if err := writeGallery(dir, filepath.Base(dir), items); err != nil {
+				a.setStatus(fmt.Sprintf("Failed to write gallery: %v", err))
+				return
+			}
+			a.setStatus(fmt.Sprintf("Gallery of %d images written to %s", len(items), dir))
+		})
+	}, a.win)
+}
@@ -0,0 +1,254 @@
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+// Offline reverse geocoding using a GeoNames gazetteer.
+// The places are read from a GeoNames cities file (e.g cities500.txt
+// from https://download.geonames.org/export/dump/). The state and
+// country names are read from admin1CodesASCII.txt and countryInfo.txt
+// in the same directory if they exist. Without them, the state is left
+// empty and the country code is used as the country.
+
+import (
+	"bufio"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Places further than this (in km) are not used to set the location.
+const maxPlaceDistance = 25
+
+// The gazetteer is read in the background, since the file is large.
+// The places are indexed by the 1 degree cell of latitude and longitude
+// holding them.
+var gazetteer struct {
+	once  sync.Once
+	ready chan nothing // Closed when the gazetteer has been read
+	cells map[[2]int][]place
+	err   error
+}
+
+// readGeoNames reads a GeoNames tab separated file, calling f with the
+// fields of each line. Comment lines are skipped.
+func readGeoNames(file string, f func([]string)) error {
+	r, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 1024*1024) // Alternate names can make long lines
+	for scanner.Scan() {
+		if l := scanner.Text(); !strings.HasPrefix(l, "#") {
+			f(strings.Split(l, "\t"))
+		}
+	}
+	return scanner.Err()
+}
+
+// readGazetteer reads the places from the GeoNames cities file.
+func readGazetteer(file string) ([]place, error) {
+	dir := filepath.Dir(file)
+	// The names are optional, so errors are ignored.
+	states := make(map[string]string)
+	readGeoNames(filepath.Join(dir, "admin1CodesASCII.txt"), func(f []string) {
+		if len(f) >= 2 {
+			states[f[0]] = f[1]
+		}
+	})
+	countries := make(map[string]string)
+	readGeoNames(filepath.Join(dir, "countryInfo.txt"), func(f []string) {
+		if len(f) >= 5 {
+			countries[f[0]] = f[4]
+		}
+	})
+	var places []place
+	err := readGeoNames(file, func(f []string) {
+		// Only populated places are used.
+		if len(f) < 11 || f[6] != "P" {
+			return
+		}
+		lat, err1 := strconv.ParseFloat(f[4], 64)
+		lon, err2 := strconv.ParseFloat(f[5], 64)
+		if err1 != nil || err2 != nil {
+			return
+		}
+		pl := place{name: f[1], state: states[f[8]+"."+f[10]], country: countries[f[8]], lat: lat, lon: lon}
+		if len(pl.country) == 0 {
+			pl.country = f[8]
+		}
+		places = append(places, pl)
+	})
+	if err == nil && len(places) == 0 {
+		err = fmt.Errorf("%s: no places", file)
+	}
+	return places, err
+}
+
+// distance returns the great circle distance in km between two positions.
+func distance(lat1, lon1, lat2, lon2 float64) float64 {
+	const earthRadius = 6371
+	rad := math.Pi / 180
+	dLat := (lat2 - lat1) * rad
+	dLon := (lon2 - lon1) * rad
+	h := math.Pow(math.Sin(dLat/2), 2) + math.Cos(lat1*rad)*math.Cos(lat2*rad)*math.Pow(math.Sin(dLon/2), 2)
+	return 2 * earthRadius * math.Asin(math.Sqrt(h))
+}
+
+// cell returns the 1 degree cell holding the position.
+func cell(lat, lon float64) [2]int {
+	return [2]int{int(math.Floor(lat)), int(math.Floor(lon))}
+}
+
+// loadGazetteer starts reading the gazetteer in the background, if it
+// has not already been started.
+func loadGazetteer() {
+	gazetteer.once.Do(func() {
+		gazetteer.ready = make(chan nothing)
+		go func() {
+			defer close(gazetteer.ready)
+			places, err := readGazetteer(*geonames)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "geonames: %v\n", err)
+			}
+			gazetteer.cells = make(map[[2]int][]place)
+			for _, pl := range places {
+				c := cell(pl.lat, pl.lon)
+				gazetteer.cells[c] = append(gazetteer.cells[c], pl)
+			}
+			gazetteer.err = err
+		}()
+	})
+}
+
+// gazetteerReady returns true if the gazetteer has been read, without waiting.
+func gazetteerReady() bool {
+	if len(*geonames) == 0 {
+		return false
+	}
+	loadGazetteer()
+	select {
+	case <-gazetteer.ready:
+		return true
+	default:
+		return false
+	}
+}
+
+// nearestPlace returns the nearest place to the position, and its distance in km.
+// Only the cells within maxPlaceDistance of the position are searched.
+// If the gazetteer is still being read, nearestPlace waits for it.
+func nearestPlace(lat, lon float64) (place, float64, error) {
+	if len(*geonames) == 0 {
+		return place{}, 0, fmt.Errorf("no GeoNames file")
+	}
+	loadGazetteer()
+	<-gazetteer.ready
+	if gazetteer.err != nil {
+		return place{}, 0, gazetteer.err
+	}
+	// A degree of latitude is about 111 km, and a degree of longitude
+	// is less, depending on the latitude.
+	const degree = 111.0
+	c := cell(lat, lon)
+	dLat := int(math.Ceil(maxPlaceDistance / degree))
+	dLon := 180
+	if w := degree * math.Cos(math.Min(math.Abs(lat)+float64(dLat), 90)*math.Pi/180); w*180 > maxPlaceDistance {
+		dLon = int(math.Ceil(maxPlaceDistance / w))
+	}
+	var nearest place
+	best := math.Inf(1)
+	for y := c[0] - dLat; y <= c[0]+dLat; y++ {
+		for x := c[1] - dLon; x <= c[1]+dLon; x++ {
+			// Wrap the longitude around at 180 degrees.
+			wx := (x+540)%360 - 180
+			for _, pl := range gazetteer.cells[[2]int{y, wx}] {
+				if d := distance(lat, lon, pl.lat, pl.lon); d < best {
+					nearest, best = pl, d
+				}
+			}
+		}
+	}
+	if math.IsInf(best, 1) {
+		return place{}, 0, fmt.Errorf("no place within %d km", maxPlaceDistance)
+	}
+	return nearest, best, nil
+}
+
+// String returns the place name, state and country.
+func (pl place) String() string {
+	var names []string
+	for _, n := range []string{pl.name, pl.state, pl.country} {
+		if len(n) != 0 {
+			names = append(names, n)
+		}
+	}
+	return joinList(names)
+}
+
+// setLocation sets the city, state and country of the image from the
+// place nearest to its GPS position.
+func setLocation(p *Pict) (place, error) {
+	pos, ok := p.Position()
+	if !ok {
+		return place{}, fmt.Errorf("no GPS position")
+	}
+	pl, d, err := nearestPlace(pos.lat, pos.lon)
+	if err != nil {
+		return pl, err
+	}
+	if d > maxPlaceDistance {
+		return pl, fmt.Errorf("no place within %d km", maxPlaceDistance)
+	}
+	for _, f := range []struct {
+		tag   int
+		value string
+	}{
+		{EXIV_CITY, pl.name},
+		{EXIV_STATE, pl.state},
+		{EXIV_COUNTRY, pl.country},
+	} {
+		if err := p.SetField(f.tag, f.value); err != nil {
+			return pl, err
+		}
+	}
+	return pl, nil
+}
+
+// fillLocation sets the city, state and country of the current image.
+func (a *Ptag) fillLocation() {
+	if len(*geonames) != 0 && !gazetteerReady() {
+		a.setStatus("Place names are still being read")
+		return
+	}
+	pl, err := setLocation(a.picts[a.index])
+	if err != nil {
+		a.setStatus(fmt.Sprintf("Failed to set location: %v", err))
+		return
+	}
+	a.setStatus(fmt.Sprintf("Location set to %s", pl))
+	a.showInfo()
+}
+
+// batchLocation sets the city, state and country of the marked images.
+func (a *Ptag) batchLocation() {
+	a.batch("Set location", false, func(p *Pict) error {
+		_, err := setLocation(p)
+		return err
+	})
+}
@@ -0,0 +1,365 @@
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+// Geotagging images from GPX tracks.
+// The capture time of each image, corrected by the camera clock offset,
+// is matched to the track. A position between two track points is
+// interpolated, and images further than the maximum gap from the nearest
+// track point are not tagged.
+
+import (
+	"encoding/xml"
+	"flag"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/storage"
+	"fyne.io/fyne/v2/widget"
+)
+
+// gpxList returns the GPX files from the -gpx flag.
+func gpxList() []string {
+	var l []string
+	for _, f := range strings.Split(*gpxFiles, ",") {
+		if f = strings.TrimSpace(f); len(f) != 0 {
+			l = append(l, f)
+		}
+	}
+	return l
+}
+
+// readGPX reads the track points from a GPX file.
+func readGPX(file string) ([]trackPoint, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var gpx struct {
+		Points []struct {
+			Lat  float64  `xml:"lat,attr"`
+			Lon  float64  `xml:"lon,attr"`
+			Ele  *float64 `xml:"ele"`
+			Time string   `xml:"time"`
+		} `xml:"trk>trkseg>trkpt"`
+	}
+	if err := xml.NewDecoder(f).Decode(&gpx); err != nil {
+		return nil, fmt.Errorf("%s: %v", file, err)
+	}
+	var track []trackPoint
+	for _, p := range gpx.Points {
+		t, err := time.Parse(time.RFC3339, strings.TrimSpace(p.Time))
+		if err != nil {
+			// Points without a time cannot be matched.
+			continue
+		}
+		tp := trackPoint{time: t, lat: p.Lat, lon: p.Lon}
+		if p.Ele != nil {
+			tp.ele, tp.hasEle = *p.Ele, true
+		}
+		track = append(track, tp)
+	}
+	return track, nil
+}
+
+// readTracks reads the GPX files, and returns the track points in time order.
+func readTracks(files []string) ([]trackPoint, error) {
+	var track []trackPoint
+	for _, f := range files {
+		t, err := readGPX(f)
+		if err != nil {
+			return nil, err
+		}
+		track = append(track, t...)
+	}
+	if len(track) == 0 {
+		return nil, fmt.Errorf("no timed track points in %s", strings.Join(files, ", "))
+	}
+	sort.Slice(track, func(i, j int) bool { return track[i].time.Before(track[j].time) })
+	return track, nil
+}
+
+// locate returns the position at the time, and the time from the nearest track point.
+// The track must not be empty.
+func locate(track []trackPoint, t time.Time) (trackPoint, time.Duration) {
+	i := sort.Search(len(track), func(i int) bool { return !track[i].time.Before(t) })
+	switch {
+	case i == len(track):
+		return track[i-1], t.Sub(track[i-1].time)
+	case i == 0 || track[i].time.Equal(t):
+		return track[i], track[i].time.Sub(t)
+	}
+	prev, next := track[i-1], track[i]
+	before, after := t.Sub(prev.time), next.time.Sub(t)
+	f := float64(before) / float64(next.time.Sub(prev.time))
+	pos := trackPoint{
+		time:   t,
+		lat:    prev.lat + f*(next.lat-prev.lat),
+		lon:    prev.lon + f*(next.lon-prev.lon),
+		ele:    prev.ele + f*(next.ele-prev.ele),
+		hasEle: prev.hasEle && next.hasEle,
+	}
+	return pos, min(before, after)
+}
+
+// cameraTimes reads the capture time of each image.
+func cameraTimes(picts []*Pict, each func([]*Pict, func(*Pict))) []geoMatch {
+	m := make([]geoMatch, len(picts))
+	index := make(map[*Pict]int)
+	for i, p := range picts {
+		m[i].p = p
+		index[p] = i
+	}
+	each(picts, func(p *Pict) {
+		if date, err := p.Date(EXIV_DATE); err == nil {
+			m[index[p]].camera, _ = parseExifTime(date)
+		}
+	})
+	return m
+}
+
+// matchTrack matches the corrected capture times to the track.
+func matchTrack(track []trackPoint, matches []geoMatch, offset time.Duration) {
+	for i := range matches {
+		m := &matches[i]
+		m.ok = false
+		if m.camera.IsZero() || len(track) == 0 {
+			continue
+		}
+		m.pos, m.delta = locate(track, m.camera.Add(offset))
+		m.ok = m.delta <= *maxGap
+	}
+}
+
+// geoReport describes the match for each image.
+func geoReport(matches []geoMatch) []string {
+	n := 0
+	var lines []string
+	for _, m := range matches {
+		var l string
+		switch {
+		case m.camera.IsZero():
+			l = "no capture time"
+		case m.ok:
+			n++
+			l = fmt.Sprintf("%s  %10.6f %11.6f", m.camera.Format("2006-01-02 15:04:05"), m.pos.lat, m.pos.lon)
+			if m.pos.hasEle {
+				l += fmt.Sprintf(" %6.0fm", m.pos.ele)
+			}
+			l += fmt.Sprintf("  (%v)", m.delta.Round(time.Second))
+		default:
+			l = fmt.Sprintf("%s  no track point within %v (nearest %v)", m.camera.Format("2006-01-02 15:04:05"), *maxGap, m.delta.Round(time.Second))
+		}
+		lines = append(lines, fmt.Sprintf("%-20s %s", m.p.Name(), l))
+	}
+	return append([]string{fmt.Sprintf("%d of %d images matched", n, len(matches))}, lines...)
+}
+
+// gpsDegrees converts an angle to degrees, minutes and seconds as
+// EXIF rationals, and the reference (pos for positive, neg for negative).
+func gpsDegrees(v float64, pos, neg string) (string, string) {
+	ref := pos
+	if v < 0 {
+		ref = neg
+	}
+	// Seconds are written to 1/100 of a second.
+	h := int64(math.Round(math.Abs(v) * 360000))
+	return fmt.Sprintf("%d/1 %d/1 %d/100", h/360000, h%360000/6000, h%6000), ref
+}
+
+// parseDegrees converts EXIF degrees, minutes and seconds to an angle,
+// which is negative if neg is set.
+func parseDegrees(s string, neg bool) (float64, bool) {
+	f := strings.Fields(s)
+	if len(f) == 0 || len(f) > 3 {
+		return 0, false
+	}
+	var v float64
+	for i, r := range f {
+		n, ok := parseRational(r)
+		if !ok {
+			return 0, false
+		}
+		v += n / math.Pow(60, float64(i))
+	}
+	if neg {
+		v = -v
+	}
+	return v, true
+}
+
+// gpsAltitude converts an elevation to an EXIF rational and the reference
+// (0 for above sea level, 1 for below).
+func gpsAltitude(ele float64) (string, string) {
+	ref := "0"
+	if ele < 0 {
+		ref = "1"
+	}
+	return fmt.Sprintf("%d/10", int64(math.Round(math.Abs(ele)*10))), ref
+}
+
+// geotagCmd geotags the images on the command line. GPX files may
+// be given as arguments, as well as using the -gpx flag.
+func geotagCmd(args []string) error {
+	fs := flag.NewFlagSet("geotag", flag.ExitOnError)
+	dryRun := fs.Bool("n", false, "Report the matches without writing the positions")
+	fs.Parse(args)
+	gpx := gpxList()
+	var images []string
+	for _, f := range expand(fs.Args()) {
+		if strings.EqualFold(filepath.Ext(f), ".gpx") {
+			gpx = append(gpx, f)
+		} else {
+			images = append(images, f)
+		}
+	}
+	if len(gpx) == 0 {
+		return fmt.Errorf("no GPX files")
+	}
+	if len(images) == 0 {
+		return fmt.Errorf("no images")
+	}
+	track, err := readTracks(gpx)
+	if err != nil {
+		return err
+	}
+	var picts []*Pict
+	for i, f := range images {
+		picts = append(picts, NewPict(f, i))
+	}
+	m := cameraTimes(picts, func(picts []*Pict, f func(*Pict)) {
+		for _, p := range picts {
+			f(p)
+		}
+	})
+	matchTrack(track, m, *clockOffset)
+	for _, l := range geoReport(m) {
+		fmt.Println(l)
+	}
+	if *dryRun {
+		return nil
+	}
+	failed := 0
+	for _, g := range m {
+		if !g.ok {
+			continue
+		}
+		if err := g.p.SetPosition(g.pos); err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", g.p.Name(), err)
+			failed++
+		}
+	}
+	if failed != 0 {
+		return fmt.Errorf("%d images failed", failed)
+	}
+	return nil
+}
+
+// geotag matches the marked images to the GPX track, and after
+// displaying the matches, writes the positions.
+// If no track has been loaded, a GPX file is selected first.
+func (a *Ptag) geotag() {
+	m := a.marked()
+	if len(m) == 0 {
+		a.setStatus("No images marked")
+		return
+	}
+	if len(a.track) == 0 && len(*gpxFiles) != 0 {
+		track, err := readTracks(gpxList())
+		if err != nil {
+			a.setStatus(fmt.Sprintf("Failed to read GPX: %v", err))
+			return
+		}
+		a.track = track
+	}
+	if len(a.track) != 0 {
+		// The capture times are read in the background, and the
+		// matches are displayed with the lock held.
+		a.setStatus("Reading capture times")
+		go func() {
+			times := cameraTimes(m, a.forAll)
+			a.locked(func() { a.showGeotag(times) })
+		}()
+		return
+	}
+	d := dialog.NewFileOpen(func(r fyne.URIReadCloser, err error) {
+		a.lock.Lock()
+		defer a.lock.Unlock()
+		if err != nil || r == nil {
+			return
+		}
+		r.Close()
+		track, err := readTracks([]string{r.URI().Path()})
+		if err != nil {
+			a.setStatus(fmt.Sprintf("Failed to read GPX: %v", err))
+			return
+		}
+		a.track = track
+		a.geotag()
+	}, a.win)
+	d.SetFilter(storage.NewExtensionFileFilter([]string{".gpx", ".GPX"}))
+	d.Show()
+}
+
+// showGeotag displays the matches, which are updated as the clock offset is changed.
+// The offset starts as the -clockoffset value, which is not changed.
+func (a *Ptag) showGeotag(m []geoMatch) {
+	track := a.track
+	offset := widget.NewEntry()
+	offset.SetText(clockOffset.String())
+	report := widget.NewLabel("")
+	report.TextStyle = fyne.TextStyle{Monospace: true}
+	update := func(s string) {
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			report.SetText(fmt.Sprintf("Illegal clock offset: %v", err))
+			return
+		}
+		matchTrack(track, m, d)
+		report.SetText(strings.Join(geoReport(m), "\n"))
+	}
+	offset.OnChanged = update
+	update(offset.Text)
+	form := widget.NewForm(widget.NewFormItem("Clock offset", offset))
+	content := container.NewBorder(form, nil, nil, nil, container.NewScroll(report))
+	d := dialog.NewCustomConfirm("Geotag marked images", "Write", "Cancel", content, func(ok bool) {
+		a.lock.Lock()
+		defer a.lock.Unlock()
+		if !ok {
+			return
+		}
+		pos := make(map[*Pict]geoMatch)
+		for _, g := range m {
+			pos[g.p] = g
+		}
+		a.batch("Geotag", false, func(p *Pict) error {
+			g := pos[p]
+			if !g.ok {
+				return fmt.Errorf("no position")
+			}
+			return p.SetPosition(g.pos)
+		})
+	}, a.win)
+	sz := a.win.Canvas().Size()
+	d.Resize(fyne.NewSize(sz.Width*0.7, sz.Height*0.7))
+	d.Show()
+}
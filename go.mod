@@ -5,6 +5,7 @@ go 1.22.2
 require (
 	fyne.io/fyne/v2 v2.4.5
 	github.com/davidbyttow/govips/v2 v2.14.0
+	golang.org/x/image v0.11.0
 )
 
 require (
@@ -28,7 +29,6 @@ require (
 	github.com/stretchr/testify v1.8.4 // indirect
 	github.com/tevino/abool v1.2.0 // indirect
 	github.com/yuin/goldmark v1.5.5 // indirect
-	golang.org/x/image v0.11.0 // indirect
 	golang.org/x/mobile v0.0.0-20230531173138-3c911d8e3eda // indirect
 	golang.org/x/net v0.17.0 // indirect
 	golang.org/x/sys v0.13.0 // indirect
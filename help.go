@@ -0,0 +1,219 @@
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+// Help overlay and command palette.
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/layout"
+	"fyne.io/fyne/v2/widget"
+)
+
+// toggleHelp shows or hides the overlay listing the actions and their keys.
+func (a *Ptag) toggleHelp() {
+	if a.help != nil && a.help.Visible() {
+		a.help.Hide()
+		return
+	}
+	form := container.New(layout.NewFormLayout())
+	for _, act := range actions {
+		keys := act.keyLabel()
+		if len(keys) == 0 {
+			keys = "-"
+		}
+		form.Add(widget.NewLabelWithStyle(keys, fyne.TextAlignTrailing, fyne.TextStyle{Monospace: true}))
+		form.Add(widget.NewLabel(act.name))
+	}
+	a.help = widget.NewPopUp(container.NewVScroll(form), a.win.Canvas())
+	a.popupCenter(a.help, 0.6, 0.8)
+}
+
+// popupCenter shows the popup in the centre of the window, sized as a fraction
+// of the window size.
+func (a *Ptag) popupCenter(p *widget.PopUp, w, h float32) {
+	sz := a.win.Canvas().Size()
+	psz := fyne.NewSize(sz.Width*w, sz.Height*h)
+	p.Resize(psz)
+	p.ShowAtPosition(fyne.NewPos((sz.Width-psz.Width)/2, (sz.Height-psz.Height)/2))
+}
+
+// showPalette shows the command palette.
+func (a *Ptag) showPalette() {
+	if a.palette == nil {
+		p := &Palette{app: a}
+		p.entry = &PaletteEntry{palette: p}
+		p.entry.ExtendBaseWidget(p.entry)
+		p.entry.SetPlaceHolder("Search commands and files")
+		p.entry.OnChanged = p.search
+		p.list = widget.NewList(
+			func() int { return len(p.matched) },
+			func() fyne.CanvasObject { return widget.NewLabel("") },
+			func(id widget.ListItemID, o fyne.CanvasObject) { o.(*widget.Label).SetText(p.matched[id].name) })
+		p.list.OnSelected = func(id widget.ListItemID) { p.selected = id }
+		p.popup = widget.NewModalPopUp(container.NewBorder(p.entry, nil, nil, nil, p.list), a.win.Canvas())
+		a.palette = p
+	}
+	a.palette.show()
+}
+
+// show builds the list of items and displays the palette.
+func (p *Palette) show() {
+	a := p.app
+	p.items = nil
+	for _, act := range actions {
+		if act.id == "palette" {
+			continue
+		}
+		act := act
+		name := act.name
+		if keys := act.keyLabel(); len(keys) != 0 {
+			name = fmt.Sprintf("%s  %s", name, keys)
+		}
+		p.items = append(p.items, paletteItem{name, func() { act.run(a) }})
+	}
+	for _, t := range templates {
+		t := t
+		p.items = append(p.items, paletteItem{fmt.Sprintf("Template: %s", t), func() { a.applyTemplate(t) }})
+		p.items = append(p.items, paletteItem{fmt.Sprintf("Marked: template: %s", t), func() { a.batchTemplate("Apply template", t) }})
+	}
+	for i, pict := range a.picts {
+		i := i
+		p.items = append(p.items, paletteItem{fmt.Sprintf("Go to: %s", pict.Name()), func() { a.setIndex(i) }})
+	}
+	p.entry.SetText("")
+	// The key that opened the palette may also generate a typed character.
+	p.entry.skip = a.lastKey
+	p.search("")
+	a.popupCenter(p.popup, 0.5, 0.6)
+	a.win.Canvas().Focus(p.entry)
+}
+
+// hide closes the palette.
+func (p *Palette) hide() {
+	p.app.win.Canvas().Unfocus()
+	p.popup.Hide()
+}
+
+// search selects the items that match the search text, best match first.
+func (p *Palette) search(text string) {
+	type scored struct {
+		item  paletteItem
+		score int
+	}
+	var m []scored
+	for _, item := range p.items {
+		if score, ok := fuzzyMatch(text, item.name); ok {
+			m = append(m, scored{item, score})
+		}
+	}
+	sort.SliceStable(m, func(i, j int) bool { return m[i].score > m[j].score })
+	p.matched = p.matched[:0]
+	for _, s := range m {
+		p.matched = append(p.matched, s.item)
+	}
+	p.list.Refresh()
+	p.move(-len(p.matched))
+}
+
+// move changes the selected item.
+func (p *Palette) move(delta int) {
+	if len(p.matched) == 0 {
+		p.selected = 0
+		p.list.UnselectAll()
+		return
+	}
+	sel := p.selected + delta
+	if sel < 0 {
+		sel = 0
+	}
+	if sel >= len(p.matched) {
+		sel = len(p.matched) - 1
+	}
+	p.list.Select(sel)
+	p.list.ScrollTo(sel)
+}
+
+// run closes the palette and runs the selected item.
+func (p *Palette) run() {
+	p.hide()
+	if p.selected >= 0 && p.selected < len(p.matched) {
+		p.app.locked(p.matched[p.selected].run)
+	}
+}
+
+// TypedKey handles the keys that navigate the palette.
+func (e *PaletteEntry) TypedKey(key *fyne.KeyEvent) {
+	e.skip = ""
+	switch key.Name {
+	case fyne.KeyEscape:
+		e.palette.hide()
+	case fyne.KeyUp:
+		e.palette.move(-1)
+	case fyne.KeyDown:
+		e.palette.move(1)
+	case fyne.KeyPageUp:
+		e.palette.move(-10)
+	case fyne.KeyPageDown:
+		e.palette.move(10)
+	case fyne.KeyReturn, fyne.KeyEnter:
+		e.palette.run()
+	default:
+		e.Entry.TypedKey(key)
+	}
+}
+
+// TypedRune ignores the character from the key that opened the palette.
+func (e *PaletteEntry) TypedRune(r rune) {
+	skip := e.skip
+	e.skip = ""
+	if len(skip) == 1 && strings.EqualFold(string(r), string(skip)) {
+		return
+	}
+	e.Entry.TypedRune(r)
+}
+
+// fuzzyMatch checks whether the characters of the pattern appear in order
+// in the string (ignoring case), and returns a score for the match.
+// Consecutive characters and characters at the start of words score higher.
+func fuzzyMatch(pattern, s string) (int, bool) {
+	pr := []rune(strings.ToLower(pattern))
+	if len(pr) == 0 {
+		return 0, true
+	}
+	score := 0
+	pi := 0
+	last := -2
+	prev := ' '
+	for i, r := range []rune(strings.ToLower(s)) {
+		if pi < len(pr) && r == pr[pi] {
+			score++
+			if last == i-1 {
+				score += 2
+			}
+			if !unicode.IsLetter(prev) && !unicode.IsDigit(prev) {
+				score += 3
+			}
+			last = i
+			pi++
+		}
+		prev = r
+	}
+	return score, pi == len(pr)
+}
@@ -0,0 +1,221 @@
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+// Histogram and clipping indicators.
+// The histogram and clipping masks are calculated from the scaled image
+// when it is loaded, so they are ready when the image is displayed.
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"os"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/canvas"
+	"fyne.io/fyne/v2/container"
+)
+
+const (
+	histWidth  = 256                    // Width of histogram image
+	histHeight = 100                    // Height of histogram image
+	clipHigh   = 254                    // Channel values at or above this are highlight clipped
+	clipLow    = 1                      // Channel values at or below this are shadow clipped
+	blinkRate  = 500 * time.Millisecond // Blink rate of clipping indicators
+)
+
+// newHistogram calculates the histogram and clipping masks of the image.
+func newHistogram(img image.Image) *Histogram {
+	b := img.Bounds()
+	h := &Histogram{
+		highlights: image.NewAlpha(b),
+		shadows:    image.NewAlpha(b),
+	}
+	add := func(x, y int, r, g, bl uint8) {
+		h.red[r]++
+		h.green[g]++
+		h.blue[bl]++
+		// Rec. 601 luma
+		h.lum[(299*int(r)+587*int(g)+114*int(bl))/1000]++
+		if r >= clipHigh || g >= clipHigh || bl >= clipHigh {
+			h.highlights.SetAlpha(x, y, color.Alpha{255})
+			h.highCount++
+		} else if r <= clipLow && g <= clipLow && bl <= clipLow {
+			h.shadows.SetAlpha(x, y, color.Alpha{255})
+			h.lowCount++
+		}
+	}
+	switch im := img.(type) {
+	case *image.RGBA:
+		for y := b.Min.Y; y < b.Max.Y; y++ {
+			for x := b.Min.X; x < b.Max.X; x++ {
+				i := im.PixOffset(x, y)
+				add(x, y, im.Pix[i], im.Pix[i+1], im.Pix[i+2])
+			}
+		}
+	case *image.NRGBA:
+		for y := b.Min.Y; y < b.Max.Y; y++ {
+			for x := b.Min.X; x < b.Max.X; x++ {
+				i := im.PixOffset(x, y)
+				add(x, y, im.Pix[i], im.Pix[i+1], im.Pix[i+2])
+			}
+		}
+	default:
+		for y := b.Min.Y; y < b.Max.Y; y++ {
+			for x := b.Min.X; x < b.Max.X; x++ {
+				c := color.NRGBAModel.Convert(img.At(x, y)).(color.NRGBA)
+				add(x, y, c.R, c.G, c.B)
+			}
+		}
+	}
+	return h
+}
+
+// render draws the histogram as an image.
+func (h *Histogram) render() image.Image {
+	img := image.NewNRGBA(image.Rect(0, 0, histWidth, histHeight))
+	// Scale to the largest bin, ignoring the end bins which
+	// will be large if the image is clipped.
+	peak := 1
+	for _, ch := range []*[256]int{&h.red, &h.green, &h.blue, &h.lum} {
+		for _, v := range ch[1:255] {
+			if v > peak {
+				peak = v
+			}
+		}
+	}
+	channels := []struct {
+		bins *[256]int
+		c    color.NRGBA
+	}{
+		{&h.lum, color.NRGBA{160, 160, 160, 255}},
+		{&h.red, color.NRGBA{255, 0, 0, 128}},
+		{&h.green, color.NRGBA{0, 255, 0, 128}},
+		{&h.blue, color.NRGBA{0, 0, 255, 128}},
+	}
+	for _, ch := range channels {
+		src := image.NewUniform(ch.c)
+		for x, v := range ch.bins {
+			y := histHeight - v*histHeight/peak
+			if y < 0 {
+				y = 0
+			}
+			draw.Draw(img, image.Rect(x, y, x+1, histHeight), src, image.Point{}, draw.Over)
+		}
+	}
+	return img
+}
+
+// newHistogramOverlay creates the (initially hidden) histogram overlay.
+func newHistogramOverlay() *HistogramOverlay {
+	h := &HistogramOverlay{}
+	h.img = canvas.NewImageFromImage(image.NewNRGBA(image.Rect(0, 0, histWidth, histHeight)))
+	h.img.FillMode = canvas.ImageFillStretch
+	h.img.SetMinSize(fyne.NewSize(histWidth, histHeight))
+	h.text = canvas.NewText("", color.White)
+	bg := canvas.NewRectangle(color.NRGBA{0, 0, 0, 160})
+	h.box = container.NewVBox(container.NewStack(bg, container.NewPadded(container.NewVBox(h.img, h.text))))
+	h.box.Hide()
+	return h
+}
+
+// toggleHistogram shows or hides the histogram.
+func (a *Ptag) toggleHistogram() {
+	if a.histo.box.Visible() {
+		a.histo.box.Hide()
+	} else {
+		a.histo.box.Show()
+		a.showHistogram()
+	}
+}
+
+// showHistogram updates the histogram for the current image.
+func (a *Ptag) showHistogram() {
+	if !a.histo.box.Visible() {
+		return
+	}
+	p := a.picts[a.index]
+	h, err := p.Histogram()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: histogram: %v\n", p.Name(), err)
+		return
+	}
+	a.histo.img.Image = h.render()
+	a.histo.img.Refresh()
+	total := h.highlights.Bounds().Dx() * h.highlights.Bounds().Dy()
+	if total == 0 {
+		total = 1
+	}
+	a.histo.text.Text = fmt.Sprintf("Clipped: high %.1f%%, low %.1f%%", float64(h.highCount)*100/float64(total), float64(h.lowCount)*100/float64(total))
+	a.histo.text.Refresh()
+}
+
+// toggleClipping starts or stops the blinking clipping indicators.
+func (a *Ptag) toggleClipping() {
+	h := a.histo
+	if h.stop != nil {
+		close(h.stop)
+		h.stop = nil
+		a.redraw()
+		return
+	}
+	h.stop = make(chan nothing)
+	go a.blinkClipping(h.stop)
+}
+
+// blinkClipping alternately shows and hides the clipped areas.
+// The goroutine only provides the timing, and the image is drawn
+// with the lock held.
+func (a *Ptag) blinkClipping(stop chan nothing) {
+	on := false
+	for {
+		select {
+		case <-stop:
+			return
+		case <-time.After(blinkRate):
+		}
+		on = !on
+		a.locked(func() {
+			// Clipping is not shown in compare mode, and the
+			// indicators may have been turned off while waiting for the lock.
+			if a.histo.stop != stop || a.compare != nil {
+				return
+			}
+			// The image is only drawn once it has been loaded.
+			p := a.picts[a.index]
+			if !p.isLoaded() {
+				return
+			}
+			if err := p.Draw(a.iDraw); err != nil {
+				return
+			}
+			if on {
+				p.DrawClipping(a.iDraw)
+			}
+			a.iCanvas.Refresh()
+		})
+	}
+}
+
+// redraw draws the current image again, without any indicators.
+func (a *Ptag) redraw() {
+	if a.compare != nil {
+		return
+	}
+	if err := a.picts[a.index].Draw(a.iDraw); err == nil {
+		a.iCanvas.Refresh()
+	}
+}
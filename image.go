@@ -15,18 +15,20 @@ package main
 // Functions to hold image data and context.
 
 import (
+	"crypto/sha256"
 	"fmt"
 	"image"
 	"image/color"
 	"image/draw"
 	"os"
 	"path"
+	"strings"
+	"time"
 
 	"github.com/davidbyttow/govips/v2/vips"
 )
 
-// Image state. This should only be changed during the
-// loading stage when the lock is active.
+// Image state. This is only changed or read with the loadLock held.
 const (
 	I_UNLOADED = iota
 	I_LOADING
@@ -37,114 +39,157 @@ const (
 // Create a new Pict, representing an image read from a file.
 func NewPict(file string, index int) *Pict {
 	_, f := path.Split(file)
-	return &Pict{state: I_UNLOADED, path: file, name: f, index: index}
+	return &Pict{state: I_UNLOADED, path: file, name: f, index: index, seq: index}
 }
 
 // wait waits for image loading to complete, and then
 // checks the result, returning any error found during the image load.
 func (p *Pict) wait() error {
-	p.lock.Wait()
+	_, err := p.loaded()
+	return err
+}
+
+// loaded waits for image loading to complete, and returns the image data,
+// which is nil if the image is not loaded.
+func (p *Pict) loaded() (*Data, error) {
+	p.loadLock.Lock()
+	done := p.loading
+	p.loadLock.Unlock()
+	if done != nil {
+		<-done
+	}
+	p.loadLock.Lock()
+	defer p.loadLock.Unlock()
 	if p.state == I_ERROR {
-		return p.err
+		return nil, p.err
+	}
+	return p.data, nil
+}
+
+// isLoaded returns true if the image data is loaded, without waiting.
+func (p *Pict) isLoaded() bool {
+	p.loadLock.Lock()
+	defer p.loadLock.Unlock()
+	return p.state == I_LOADED && p.data != nil
+}
+
+// ready waits for any loading to complete, and ensures that the
+// EXIF data has been read, since the image itself may not be loaded.
+func (p *Pict) ready() error {
+	if err := p.wait(); err != nil {
+		return err
 	}
+	p.loadExif(nil)
 	return nil
 }
 
+// loadExif reads the EXIF data if it doesn't already exist.
+func (p *Pict) loadExif(buf []byte) {
+	p.exifLock.Lock()
+	defer p.exifLock.Unlock()
+	if p.exif == nil {
+		var err error
+		p.exif, err = GetExif(p.path, buf)
+		if err != nil {
+			// We do allow an error when reading the EXIF.
+			// This usually means there is no EXIF headers in the file
+			if *verbose {
+				fmt.Printf("%s (%d): No exif data!\n", p.name, p.index)
+			}
+		} else {
+			if *verbose {
+				fmt.Printf("%s (%d): exif loaded\n", p.name, p.index)
+			}
+		}
+	}
+}
+
+// getExif returns an EXIF value. The lock is held since the
+// EXIF data may be updated from background goroutines.
+func (p *Pict) getExif(tag int) (string, bool) {
+	p.exifLock.Lock()
+	defer p.exifLock.Unlock()
+	return p.exif.Get(tag)
+}
+
+// setExif sets an EXIF value.
+func (p *Pict) setExif(tag int, value string) error {
+	p.exifLock.Lock()
+	defer p.exifLock.Unlock()
+	return p.exif.Set(tag, value)
+}
+
+// deleteExif removes an EXIF value.
+func (p *Pict) deleteExif(tag int) error {
+	p.exifLock.Lock()
+	defer p.exifLock.Unlock()
+	return p.exif.Delete(tag)
+}
+
 // StartLoad sets up to load and process the image.
 // The actual reading is delegated to a background goroutine.
 // After calling startLoad, the wait function must be called before
 // the image data is accessed.
 func (p *Pict) StartLoad(w, h int) {
 	p.wait() // Ensure loading is not already in progress
-	// If loaded already, don't reload
-	if p.state == I_LOADED {
+	p.loadLock.Lock()
+	defer p.loadLock.Unlock()
+	// If loaded or loading already, don't reload
+	if p.state == I_LOADED || p.state == I_LOADING {
 		return
 	}
 	// The image is not loaded.
-	p.Unload()
+	p.clean()
 	if *verbose {
 		fmt.Printf("%s (index %d): loading...\n", p.name, p.index)
 	}
-	p.lock.Add(1)
 	p.state = I_LOADING
+	p.loading = make(chan nothing)
 	go p.load(w, h)
 }
 
+// finish records the result of loading the image, and
+// releases any goroutines waiting for the load.
+func (p *Pict) finish(d *Data, err error) {
+	p.loadLock.Lock()
+	defer p.loadLock.Unlock()
+	if err != nil {
+		p.state = I_ERROR
+		p.err = err
+	} else {
+		p.data = d
+		p.state = I_LOADED
+	}
+	close(p.loading)
+	p.loading = nil
+}
+
 // load reads and if necessary resizes the image ready for display.
 // wait() must be called before the image can be accessed to
 // ensure that the load is complete.
 func (p *Pict) load(w, h int) {
-	defer p.lock.Done()
-	p.clean()
 	fData, err := os.ReadFile(p.path)
 	if err != nil {
-		p.state = I_ERROR
-		p.err = err
+		p.finish(nil, err)
 		return
 	}
 	// Read the EXIF data if it doesn't already exist.
 	// This is read first so that the EXIF orientation can be used
 	// to flip the image if necessary.
-	if p.exif == nil {
-		var err error
-		p.exif, err = GetExif(p.path, fData)
-		if err != nil {
-			// We do allow an error when reading the EXIF.
-			// This usually means there is no EXIF headers in the file
-			if *verbose {
-				fmt.Printf("%s (%d): No exif data!\n", p.name, p.index)
-			}
-		} else {
-			if *verbose {
-				fmt.Printf("%s (%d): exif loaded\n", p.name, p.index)
-			}
-		}
-	}
+	p.loadExif(fData)
 
 	// Read the image from the file.
 	vimg, err := vips.NewImageFromBuffer(fData)
 	if err != nil {
-		p.state = I_ERROR
-		p.err = err
+		p.finish(nil, err)
 		return
 	}
-	// EXIF orientation map
-	adjustMap := map[string]struct {
-		rotate vips.Angle
-		flip   bool
-	}{
-		"1": {vips.Angle0, false},
-		"2": {vips.Angle0, true},
-		"3": {vips.Angle180, false},
-		"4": {vips.Angle180, true},
-		"5": {vips.Angle90, true},
-		"6": {vips.Angle90, false},
-		"7": {vips.Angle270, true},
-		"8": {vips.Angle270, false},
-	}
-	// Get EXIF orientation, if any
-	orient, ok := p.exif.Get(EXIV_ORIENTATION)
-	if !ok {
-		orient = "1" // No orientation EXIF, no adjustment required
-	}
-	adjust, ok := adjustMap[orient]
-	if ok {
-		// Rotate before flip (if any)
-		if adjust.rotate != vips.Angle0 {
-			vimg.Rotate(adjust.rotate)
-			if *verbose {
-				fmt.Printf("%s (%d): rotating %v\n", p.name, p.index, adjust.rotate)
-			}
-		}
-		if adjust.flip {
-			vimg.Flip(vips.DirectionHorizontal)
-			if *verbose {
-				fmt.Printf("%s (%d): flipping\n", p.name, p.index)
-			}
-		}
-	}
+	p.orient(vimg)
 	iW := vimg.Width()
 	iH := vimg.Height()
+	p.loadLock.Lock()
+	p.size = image.Pt(iW, iH)
+	p.loadLock.Unlock()
 	// Scale the image to fit the requested size
 	xRatio := float32(w) / float32(iW)
 	yRatio := float32(h) / float32(iH)
@@ -167,8 +212,7 @@ func (p *Pict) load(w, h int) {
 			x = (w - vimg.Width()) / 2
 		}
 		if err != nil {
-			p.state = I_ERROR
-			p.err = err
+			p.finish(nil, err)
 			return
 		}
 	} else {
@@ -179,10 +223,12 @@ func (p *Pict) load(w, h int) {
 	// Convert to image.Image
 	d.img, err = vimg.ToImage(vips.NewDefaultExportParams())
 	if err != nil {
-		p.state = I_ERROR
-		p.err = err
+		p.finish(nil, err)
 		return
 	}
+	// Calculate the histogram here so that it is ready when the image is displayed.
+	d.hist = newHistogram(d.img)
+	p.setHash(imageHash(d.img), sha256.Sum256(fData))
 	// If there are any surrounding margins, create a list of areas to be cleared.
 	if x < 0 {
 		x = 0
@@ -210,26 +256,98 @@ func (p *Pict) load(w, h int) {
 		}
 	}
 	// Save the cached image data.
-	p.data = d
-	p.state = I_LOADED
+	p.finish(d, nil)
+}
+
+// orient rotates and flips the image according to the EXIF orientation.
+func (p *Pict) orient(vimg *vips.ImageRef) {
+	// EXIF orientation map
+	adjustMap := map[string]struct {
+		rotate vips.Angle
+		flip   bool
+	}{
+		"1": {vips.Angle0, false},
+		"2": {vips.Angle0, true},
+		"3": {vips.Angle180, false},
+		"4": {vips.Angle180, true},
+		"5": {vips.Angle90, true},
+		"6": {vips.Angle90, false},
+		"7": {vips.Angle270, true},
+		"8": {vips.Angle270, false},
+	}
+	// Get EXIF orientation, if any
+	orient, ok := p.getExif(EXIV_ORIENTATION)
+	if !ok {
+		orient = "1" // No orientation EXIF, no adjustment required
+	}
+	adjust, ok := adjustMap[orient]
+	if ok {
+		// Rotate before flip (if any)
+		if adjust.rotate != vips.Angle0 {
+			vimg.Rotate(adjust.rotate)
+			if *verbose {
+				fmt.Printf("%s (%d): rotating %v\n", p.name, p.index, adjust.rotate)
+			}
+		}
+		if adjust.flip {
+			vimg.Flip(vips.DirectionHorizontal)
+			if *verbose {
+				fmt.Printf("%s (%d): flipping\n", p.name, p.index)
+			}
+		}
+	}
 }
 
 // draw writes the image to the backing image of the canvas,
 // and clears any surrounding margins.
+// The image is drawn relative to the origin of dst, so that a
+// sub-image may be used as the destination.
 func (p *Pict) Draw(dst draw.Image) error {
-	if err := p.wait(); err != nil {
+	d, err := p.loaded()
+	if err != nil {
 		return err
 	}
-	d := p.data
-	draw.Draw(dst, d.location, d.img, image.ZP, draw.Src)
+	if d == nil {
+		return fmt.Errorf("image not loaded")
+	}
+	origin := dst.Bounds().Min
+	draw.Draw(dst, d.location.Add(origin), d.img, image.ZP, draw.Src)
 	// Clear the margins.
 	black := image.NewUniform(color.Black)
-	for _, cl := range p.data.cleared {
-		draw.Draw(dst, cl, black, image.ZP, draw.Src)
+	for _, cl := range d.cleared {
+		draw.Draw(dst, cl.Add(origin), black, image.ZP, draw.Src)
+	}
+	return nil
+}
+
+// DrawClipping highlights the clipped areas of the image.
+// Draw must be called before this.
+func (p *Pict) DrawClipping(dst draw.Image) error {
+	d, err := p.loaded()
+	if err != nil {
+		return err
 	}
+	if d == nil {
+		return fmt.Errorf("image not loaded")
+	}
+	r := d.location.Add(dst.Bounds().Min)
+	draw.DrawMask(dst, r, image.NewUniform(color.NRGBA{255, 0, 0, 255}), image.ZP, d.hist.highlights, d.img.Bounds().Min, draw.Over)
+	draw.DrawMask(dst, r, image.NewUniform(color.NRGBA{0, 0, 255, 255}), image.ZP, d.hist.shadows, d.img.Bounds().Min, draw.Over)
 	return nil
 }
 
+// Histogram returns the histogram of the displayed image.
+func (p *Pict) Histogram() (*Histogram, error) {
+	d, err := p.loaded()
+	if err != nil {
+		return nil, err
+	}
+	if d == nil {
+		return nil, fmt.Errorf("image not loaded")
+	}
+	return d.hist, nil
+}
+
 // Title returns the current title
 func (p *Pict) Title() string {
 	return p.title
@@ -252,17 +370,17 @@ func (p *Pict) SetTitle(title string) {
 
 // Rating returns the current rating, -1 if none
 func (p *Pict) Rating() (int, error) {
-	if err := p.wait(); err != nil {
+	if err := p.ready(); err != nil {
 		return 0, err
 	}
-	if r, ok := p.exif.Get(EXIV_RATING); ok {
+	if r, ok := p.getExif(EXIV_RATING); ok {
 		var rating int
 		n, err := fmt.Sscanf(r, "%d", &rating)
 		if err != nil {
 			return -1, err
 		}
 		if n != 1 || rating < 0 || rating > 5 {
-			return -1, fmt.Errorf("%s: illegal rating")
+			return -1, fmt.Errorf("%s: illegal rating", r)
 		}
 		return rating, nil
 	} else {
@@ -273,27 +391,27 @@ func (p *Pict) Rating() (int, error) {
 // SetRating sets a rating (0-5) on this image.
 // -1 will delete the rating
 func (p *Pict) SetRating(rating int) error {
-	if err := p.wait(); err != nil {
+	if err := p.ready(); err != nil {
 		return err
 	}
 	if *verbose {
 		fmt.Printf("Set rating of %s to %d\n", p.name, rating)
 	}
 	if rating < 0 {
-		return p.exif.Delete(EXIV_RATING)
+		return p.deleteExif(EXIV_RATING)
 	}
 	if rating > 5 {
 		return fmt.Errorf("%d: illegal rating", rating)
 	}
-	return p.exif.Set(EXIV_RATING, fmt.Sprintf("%d", rating))
+	return p.setExif(EXIV_RATING, fmt.Sprintf("%d", rating))
 }
 
 // Orientation returns the current orientation, "" if none
 func (p *Pict) Orientation() (string, error) {
-	if err := p.wait(); err != nil {
+	if err := p.ready(); err != nil {
 		return "", err
 	}
-	if r, ok := p.exif.Get(EXIV_ORIENTATION); ok {
+	if r, ok := p.getExif(EXIV_ORIENTATION); ok {
 		return r, nil
 	} else {
 		return "", nil
@@ -303,24 +421,163 @@ func (p *Pict) Orientation() (string, error) {
 // SetOrientation sets an orientation ("1" - "8") on this image.
 // "" will delete the rating
 func (p *Pict) SetOrientation(orientation string) error {
-	if err := p.wait(); err != nil {
+	if err := p.ready(); err != nil {
 		return err
 	}
 	if *verbose {
 		fmt.Printf("Set orientation of %s to %s\n", p.name, orientation)
 	}
 	if orientation == "" {
-		return p.exif.Delete(EXIV_ORIENTATION)
+		return p.deleteExif(EXIV_ORIENTATION)
+	}
+	return p.setExif(EXIV_ORIENTATION, orientation)
+}
+
+// AdjustOrientation selects a new orientation value using
+// the current orientation as the key, returning the old and new orientation.
+func (p *Pict) AdjustOrientation(adj map[string]string) (string, string, error) {
+	current, err := p.Orientation()
+	if err != nil {
+		return "", "", err
+	}
+	newO, ok := adj[current]
+	if !ok {
+		return current, "", fmt.Errorf("unknown orientation: %s", current)
+	}
+	return current, newO, p.SetOrientation(newO)
+}
+
+// Label returns the current colour label, "" if none
+func (p *Pict) Label() (string, error) {
+	if err := p.ready(); err != nil {
+		return "", err
+	}
+	if r, ok := p.getExif(EXIV_LABEL); ok {
+		return r, nil
+	} else {
+		return "", nil
+	}
+}
+
+// SetLabel sets a colour label on this image.
+// An empty label will delete the label
+func (p *Pict) SetLabel(label string) error {
+	if err := p.ready(); err != nil {
+		return err
+	}
+	if *verbose {
+		fmt.Printf("Set label of %s to %s\n", p.name, label)
+	}
+	if len(label) == 0 {
+		return p.deleteExif(EXIV_LABEL)
+	}
+	return p.setExif(EXIV_LABEL, label)
+}
+
+// Keywords returns the hierarchical keywords e.g Places|Australia|Sydney
+func (p *Pict) Keywords() ([]string, error) {
+	if err := p.ready(); err != nil {
+		return nil, err
+	}
+	r, _ := p.getExif(EXIV_KEYWORDS)
+	return splitList(r), nil
+}
+
+// SetKeywords sets the hierarchical keywords, and updates the flat
+// keywords (subject) to include each keyword and its ancestors.
+// Flat keywords that did not come from the hierarchical keywords are kept.
+func (p *Pict) SetKeywords(keywords []string) error {
+	if err := p.ready(); err != nil {
+		return err
+	}
+	if *verbose {
+		fmt.Printf("Set keywords of %s to %s\n", p.name, strings.Join(keywords, ", "))
+	}
+	old, _ := p.getExif(EXIV_KEYWORDS)
+	subject, _ := p.getExif(EXIV_SUBJECT)
+	s := mergeSubject(splitList(subject), splitList(old), keywords)
+	var err error
+	if len(keywords) == 0 {
+		err = p.deleteExif(EXIV_KEYWORDS)
+	} else {
+		err = p.setExif(EXIV_KEYWORDS, joinList(keywords))
+	}
+	if err != nil {
+		return err
+	}
+	if len(s) == 0 {
+		return p.deleteExif(EXIV_SUBJECT)
+	}
+	return p.setExif(EXIV_SUBJECT, joinList(s))
+}
+
+// SetPosition sets the GPS position. If the elevation is not known,
+// any existing altitude is removed.
+func (p *Pict) SetPosition(pos trackPoint) error {
+	if err := p.ready(); err != nil {
+		return err
+	}
+	if *verbose {
+		fmt.Printf("Set position of %s to %.6f, %.6f\n", p.name, pos.lat, pos.lon)
+	}
+	lat, latRef := gpsDegrees(pos.lat, "N", "S")
+	lon, lonRef := gpsDegrees(pos.lon, "E", "W")
+	var alt, altRef string
+	if pos.hasEle {
+		alt, altRef = gpsAltitude(pos.ele)
+	}
+	for _, f := range []struct {
+		tag   int
+		value string
+	}{
+		{EXIV_GPS_LATITUDE, lat},
+		{EXIV_GPS_LATITUDE_REF, latRef},
+		{EXIV_GPS_LONGITUDE, lon},
+		{EXIV_GPS_LONGITUDE_REF, lonRef},
+		{EXIV_GPS_ALTITUDE, alt},
+		{EXIV_GPS_ALTITUDE_REF, altRef},
+	} {
+		var err error
+		if len(f.value) == 0 {
+			err = p.deleteExif(f.tag)
+		} else {
+			err = p.setExif(f.tag, f.value)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Position returns the GPS position, if any.
+func (p *Pict) Position() (trackPoint, bool) {
+	var pos trackPoint
+	if err := p.ready(); err != nil {
+		return pos, false
+	}
+	lat, _ := p.getExif(EXIV_GPS_LATITUDE)
+	latRef, _ := p.getExif(EXIV_GPS_LATITUDE_REF)
+	lon, _ := p.getExif(EXIV_GPS_LONGITUDE)
+	lonRef, _ := p.getExif(EXIV_GPS_LONGITUDE_REF)
+	var ok1, ok2 bool
+	pos.lat, ok1 = parseDegrees(lat, latRef == "S")
+	pos.lon, ok2 = parseDegrees(lon, lonRef == "W")
+	if alt, ok := p.getExif(EXIV_GPS_ALTITUDE); ok {
+		pos.ele, pos.hasEle = parseRational(alt)
+		if ref, _ := p.getExif(EXIV_GPS_ALTITUDE_REF); ref == "1" {
+			pos.ele = -pos.ele
+		}
 	}
-	return p.exif.Set(EXIV_ORIENTATION, orientation)
+	return pos, ok1 && ok2
 }
 
 // Caption returns the current caption (if any)
 func (p *Pict) Caption() (string, error) {
-	if err := p.wait(); err != nil {
+	if err := p.ready(); err != nil {
 		return "", err
 	}
-	if r, ok := p.exif.Get(EXIV_HEADLINE); ok {
+	if r, ok := p.getExif(EXIV_HEADLINE); ok {
 		return r, nil
 	} else {
 		return "", nil
@@ -330,30 +587,190 @@ func (p *Pict) Caption() (string, error) {
 // SetCaption sets a caption on the EXIF.
 // An empty caption will delete the caption
 func (p *Pict) SetCaption(caption string) error {
-	if err := p.wait(); err != nil {
+	if err := p.ready(); err != nil {
 		return err
 	}
 	if *verbose {
 		fmt.Printf("Set caption of %s to %s\n", p.name, caption)
 	}
 	if len(caption) == 0 {
-		return p.exif.Delete(EXIV_HEADLINE)
+		return p.deleteExif(EXIV_HEADLINE)
+	}
+	return p.setExif(EXIV_HEADLINE, caption)
+}
+
+// Field returns the value of a text field such as the title or description.
+func (p *Pict) Field(tag int) (string, error) {
+	if err := p.ready(); err != nil {
+		return "", err
+	}
+	r, _ := p.getExif(tag)
+	return r, nil
+}
+
+// SetField sets a text field such as the title or description.
+// An empty value will delete the field.
+func (p *Pict) SetField(tag int, value string) error {
+	if err := p.ready(); err != nil {
+		return err
+	}
+	if *verbose {
+		fmt.Printf("Set field %d of %s to %s\n", tag, p.name, value)
+	}
+	if len(value) == 0 {
+		return p.deleteExif(tag)
+	}
+	return p.setExif(tag, value)
+}
+
+// Date returns a date/time field such as the capture time. A value set
+// through the EXIF handler is used in preference to the value in the image.
+func (p *Pict) Date(tag int) (string, error) {
+	if err := p.ready(); err != nil {
+		return "", err
 	}
-	return p.exif.Set(EXIV_HEADLINE, caption)
+	if r, ok := p.getExif(tag); ok {
+		return r, nil
+	}
+	info, err := p.Info()
+	if err != nil {
+		return "", err
+	}
+	return info[tag], nil
+}
+
+// ShiftTime adds the offset to the capture and creation dates.
+func (p *Pict) ShiftTime(offset time.Duration) error {
+	if err := p.ready(); err != nil {
+		return err
+	}
+	if *verbose {
+		fmt.Printf("Shift time of %s by %v\n", p.name, offset)
+	}
+	shifted := false
+	for _, tag := range []int{EXIV_DATE, EXIV_CREATE_DATE} {
+		v, err := p.Date(tag)
+		if err != nil {
+			return err
+		}
+		if len(v) == 0 {
+			continue
+		}
+		// The time has no zone, so UTC is used to avoid daylight saving changes.
+		t, err := time.Parse(exifTimeFormat, v)
+		if err != nil {
+			return fmt.Errorf("illegal date (%s)", v)
+		}
+		if err := p.setExif(tag, t.Add(offset).Format(exifTimeFormat)); err != nil {
+			return err
+		}
+		shifted = true
+	}
+	if !shifted {
+		return fmt.Errorf("no capture time")
+	}
+	return nil
+}
+
+// Info returns the shooting information, reading it on first use.
+func (p *Pict) Info() (map[int]string, error) {
+	if err := p.wait(); err != nil {
+		return nil, err
+	}
+	p.exifLock.Lock()
+	defer p.exifLock.Unlock()
+	if p.info == nil {
+		p.info = readInfo(p.path)
+	}
+	return p.info, nil
+}
+
+// setHash records the perceptual hash of the image and the checksum of the file.
+func (p *Pict) setHash(hash uint64, sum [32]byte) {
+	p.hashLock.Lock()
+	defer p.hashLock.Unlock()
+	p.hash, p.sum, p.hashed = hash, sum, true
+}
+
+// Hashes returns the perceptual hash of the image and the checksum of the
+// file. If they were not calculated when the image was loaded, the image is read.
+func (p *Pict) Hashes() (uint64, [32]byte, error) {
+	p.hashLock.Lock()
+	hash, sum, hashed := p.hash, p.sum, p.hashed
+	p.hashLock.Unlock()
+	if hashed {
+		return hash, sum, nil
+	}
+	// The orientation is needed so that the hash matches a loaded image.
+	if err := p.ready(); err != nil {
+		return 0, sum, err
+	}
+	fData, err := os.ReadFile(p.path)
+	if err != nil {
+		return 0, sum, err
+	}
+	vimg, err := vips.NewImageFromBuffer(fData)
+	if err != nil {
+		return 0, sum, err
+	}
+	defer vimg.Close()
+	p.orient(vimg)
+	if scale := float64(hashSize) / float64(max(vimg.Width(), vimg.Height())); scale < 1 {
+		if err := vimg.Resize(scale, vips.KernelAuto); err != nil {
+			return 0, sum, err
+		}
+	}
+	img, err := vimg.ToImage(vips.NewDefaultExportParams())
+	if err != nil {
+		return 0, sum, err
+	}
+	hash, sum = imageHash(img), sha256.Sum256(fData)
+	p.setHash(hash, sum)
+	return hash, sum, nil
+}
+
+// Thumbnail reads the image, and returns it oriented and reduced to fit within the size.
+func (p *Pict) Thumbnail(w, h int) (image.Image, error) {
+	if err := p.ready(); err != nil {
+		return nil, err
+	}
+	vimg, err := vips.NewImageFromFile(p.path)
+	if err != nil {
+		return nil, err
+	}
+	defer vimg.Close()
+	p.orient(vimg)
+	scale := min(float64(w)/float64(vimg.Width()), float64(h)/float64(vimg.Height()))
+	if scale < 1 {
+		if err := vimg.Resize(scale, vips.KernelAuto); err != nil {
+			return nil, err
+		}
+	}
+	return vimg.ToImage(vips.NewDefaultExportParams())
+}
+
+// Size returns the size of the original image, once it has been loaded.
+func (p *Pict) Size() image.Point {
+	p.loadLock.Lock()
+	defer p.loadLock.Unlock()
+	return p.size
 }
 
 // unload clears out the cached image data and sets the picture to unloaded.
 func (p *Pict) Unload() {
+	p.wait() // If loading, wait for the load to complete before clearing.
+	p.loadLock.Lock()
+	defer p.loadLock.Unlock()
 	if p.state != I_UNLOADED {
 		if *verbose {
 			fmt.Printf("Unloading %s, index %d\n", p.name, p.index)
 		}
-		p.wait() // If loading, wait for the load to complete before clearing.
 		p.clean()
 	}
 }
 
 // clean clears the image data to free the memory.
+// The loadLock must be held.
 func (p *Pict) clean() {
 	p.state = I_UNLOADED
 	p.data = nil
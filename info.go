@@ -0,0 +1,172 @@
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+// Overlay displaying the shooting information of the current image.
+
+import (
+	"fmt"
+	"image/color"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/canvas"
+	"fyne.io/fyne/v2/container"
+)
+
+// newInfoOverlay creates the (initially hidden) information overlay.
+func newInfoOverlay() *InfoOverlay {
+	i := &InfoOverlay{lines: container.NewVBox()}
+	bg := canvas.NewRectangle(color.NRGBA{0, 0, 0, 160})
+	i.box = container.NewVBox(container.NewStack(bg, container.NewPadded(i.lines)))
+	i.box.Hide()
+	return i
+}
+
+// toggleInfo shows or hides the information overlay.
+func (a *Ptag) toggleInfo() {
+	if a.info.box.Visible() {
+		a.info.box.Hide()
+	} else {
+		a.info.box.Show()
+		a.showInfo()
+	}
+}
+
+// showInfo updates the information overlay for the current image.
+func (a *Ptag) showInfo() {
+	if !a.info.box.Visible() {
+		return
+	}
+	p := a.picts[a.index]
+	info, err := p.Info()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: info: %v\n", p.Name(), err)
+		info = map[int]string{}
+	}
+	a.info.lines.RemoveAll()
+	for _, l := range infoLines(info, p) {
+		t := canvas.NewText(l, color.White)
+		t.TextStyle = fyne.TextStyle{Monospace: true}
+		a.info.lines.Add(t)
+	}
+	a.info.box.Refresh()
+}
+
+// infoLines formats the shooting information for display.
+func infoLines(info map[int]string, p *Pict) []string {
+	var lines []string
+	add := func(label, value string) {
+		if len(value) != 0 {
+			lines = append(lines, fmt.Sprintf("%-9s %s", label+":", value))
+		}
+	}
+	add("Camera", cameraName(info))
+	add("Lens", info[EXIV_LENS])
+	if f, ok := parseRational(info[EXIV_FOCAL_LENGTH]); ok {
+		add("Focal", fmt.Sprintf("%s mm", strconv.FormatFloat(f, 'f', -1, 64)))
+	}
+	if f, ok := parseRational(info[EXIV_FNUMBER]); ok {
+		add("Aperture", fmt.Sprintf("f/%s", strconv.FormatFloat(f, 'f', -1, 64)))
+	}
+	add("Shutter", formatExposure(info[EXIV_EXPOSURE]))
+	if iso := info[EXIV_ISO]; len(iso) != 0 {
+		add("ISO", iso)
+	}
+	date, _ := p.Date(EXIV_DATE)
+	if d, err := parseExifTime(date); err == nil {
+		add("Date", d.Format("2006-01-02 15:04:05"))
+	} else {
+		add("Date", date)
+	}
+	if pos, ok := p.Position(); ok {
+		gps := fmt.Sprintf("%.6f, %.6f", pos.lat, pos.lon)
+		if pos.hasEle {
+			gps += fmt.Sprintf(" (%.0f m)", pos.ele)
+		}
+		add("GPS", gps)
+		// Nothing is shown until the gazetteer has been read.
+		if gazetteerReady() {
+			if pl, d, err := nearestPlace(pos.lat, pos.lon); err == nil {
+				add("Near", fmt.Sprintf("%s (%.1f km)", pl, d))
+			}
+		}
+	}
+	var loc []string
+	for _, tag := range []int{EXIV_CITY, EXIV_STATE, EXIV_COUNTRY} {
+		if v, _ := p.Field(tag); len(v) != 0 {
+			loc = append(loc, v)
+		}
+	}
+	add("Location", joinList(loc))
+	if kw, _ := p.Keywords(); len(kw) != 0 {
+		add("Keywords", strings.Join(kw, ", "))
+	}
+	if sz := p.Size(); sz.X != 0 {
+		add("Size", fmt.Sprintf("%d x %d (%.1f MP)", sz.X, sz.Y, float64(sz.X*sz.Y)/1e6))
+	}
+	return lines
+}
+
+// cameraName returns the camera make and model.
+func cameraName(info map[int]string) string {
+	camera := info[EXIV_MODEL]
+	// The model often includes the make.
+	if mk := strings.Fields(info[EXIV_MAKE]); len(mk) != 0 && !strings.HasPrefix(strings.ToLower(camera), strings.ToLower(mk[0])) {
+		camera = strings.TrimSpace(info[EXIV_MAKE] + " " + camera)
+	}
+	return camera
+}
+
+// parseRational converts an EXIF rational value (e.g "28/10") to a float.
+func parseRational(s string) (float64, bool) {
+	if len(s) == 0 {
+		return 0, false
+	}
+	num, den, found := strings.Cut(s, "/")
+	n, err := strconv.ParseFloat(num, 64)
+	if err != nil {
+		return 0, false
+	}
+	if !found {
+		return n, true
+	}
+	d, err := strconv.ParseFloat(den, 64)
+	if err != nil || d == 0 {
+		return 0, false
+	}
+	return n / d, true
+}
+
+// formatExposure converts an EXIF exposure time to a shutter speed.
+func formatExposure(s string) string {
+	t, ok := parseRational(s)
+	if !ok || t <= 0 {
+		return ""
+	}
+	if t < 1 {
+		return fmt.Sprintf("1/%.0f s", 1/t)
+	}
+	return fmt.Sprintf("%s s", strconv.FormatFloat(t, 'f', -1, 64))
+}
+
+// Format of EXIF date/time values.
+const exifTimeFormat = "2006:01:02 15:04:05"
+
+// parseExifTime parses an EXIF date/time value.
+func parseExifTime(s string) (time.Time, error) {
+	return time.ParseInLocation(exifTimeFormat, s, time.Local)
+}
@@ -0,0 +1,243 @@
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+// Hierarchical keywords, compatible with Lightroom.
+// Keywords are stored as paths such as Places|Australia|Sydney in
+// lr:hierarchicalSubject, and each keyword and its ancestors are also
+// stored as flat keywords in dc:subject.
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+)
+
+// Separator between the levels of a hierarchical keyword.
+const keywordSep = "|"
+
+// Keywords read from the keyword vocabulary file.
+var keywordVocab []string
+
+// readKeywords reads a keyword vocabulary file. The file may be a
+// Lightroom keyword export, where each level of the hierarchy is
+// indented by a tab, or may contain keyword paths e.g Places|Australia.
+// Synonyms (in braces) are ignored, and brackets around keywords are removed.
+func readKeywords(file string) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	var parents []string
+	for scanner.Scan() {
+		l := scanner.Text()
+		depth := len(l) - len(strings.TrimLeft(l, "\t"))
+		k := strings.TrimSpace(l)
+		if len(k) == 0 || strings.HasPrefix(k, "#") || strings.HasPrefix(k, "{") {
+			continue
+		}
+		k = strings.TrimSuffix(strings.TrimPrefix(k, "["), "]")
+		if depth > len(parents) {
+			depth = len(parents)
+		}
+		parents = append(parents[:depth], k)
+		kw, err := cleanKeyword(strings.Join(parents, keywordSep))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", file, err)
+			continue
+		}
+		keywordVocab = append(keywordVocab, kw)
+	}
+	return scanner.Err()
+}
+
+// splitList splits a list of items as printed by exiv2.
+func splitList(s string) []string {
+	var l []string
+	for _, item := range strings.Split(s, ", ") {
+		if item = strings.TrimSpace(item); len(item) != 0 {
+			l = append(l, item)
+		}
+	}
+	return l
+}
+
+// joinList joins a list of items in the form printed by exiv2.
+func joinList(l []string) string {
+	return strings.Join(l, ", ")
+}
+
+// cleanKeyword removes extra spaces and empty levels from a keyword path.
+// The keywords are stored as a comma separated list, so a keyword
+// containing a comma is rejected.
+func cleanKeyword(k string) (string, error) {
+	if strings.Contains(k, ",") {
+		return "", fmt.Errorf("keyword cannot contain a comma (%s)", k)
+	}
+	var levels []string
+	for _, l := range strings.Split(k, keywordSep) {
+		if l = strings.TrimSpace(l); len(l) != 0 {
+			levels = append(levels, l)
+		}
+	}
+	return strings.Join(levels, keywordSep), nil
+}
+
+// flatten returns each level of the keywords as flat keywords.
+func flatten(keywords []string) map[string]nothing {
+	flat := make(map[string]nothing)
+	for _, k := range keywords {
+		for _, l := range strings.Split(k, keywordSep) {
+			flat[l] = nothing{}
+		}
+	}
+	return flat
+}
+
+// mergeSubject returns the new flat keywords, keeping the flat keywords
+// that did not come from the old hierarchical keywords.
+func mergeSubject(subject, old, keywords []string) []string {
+	derived := flatten(old)
+	s := flatten(keywords)
+	for _, k := range subject {
+		if _, ok := derived[k]; !ok {
+			s[k] = nothing{}
+		}
+	}
+	var l []string
+	for k := range s {
+		l = append(l, k)
+	}
+	sort.Strings(l)
+	return l
+}
+
+// keywordTree maps each keyword path to its children.
+type keywordTree map[string][]string
+
+// add adds the keyword and its ancestors to the tree.
+func (t keywordTree) add(k string) {
+	levels := strings.Split(k, keywordSep)
+	parent := ""
+	for i := range levels {
+		path := strings.Join(levels[:i+1], keywordSep)
+		if !contains(t[parent], path) {
+			t[parent] = append(t[parent], path)
+			sort.Strings(t[parent])
+		}
+		parent = path
+	}
+}
+
+// ancestors returns the ancestors of a keyword path.
+func ancestors(k string) []string {
+	var a []string
+	for i := range k {
+		if strings.HasPrefix(k[i:], keywordSep) {
+			a = append(a, k[:i])
+		}
+	}
+	return a
+}
+
+// pickKeywords displays the keyword tree, to select the keywords of the current image.
+func (a *Ptag) pickKeywords() {
+	a.Sync()
+	p := a.picts[a.index]
+	current, err := p.Keywords()
+	if err != nil {
+		a.setStatus(fmt.Sprintf("Failed to read keywords: %v", err))
+		return
+	}
+	tree := keywordTree{}
+	selected := make(map[string]bool)
+	for _, k := range keywordVocab {
+		tree.add(k)
+	}
+	for _, k := range current {
+		tree.add(k)
+		selected[k] = true
+	}
+	t := widget.NewTree(
+		func(id widget.TreeNodeID) []widget.TreeNodeID { return tree[id] },
+		func(id widget.TreeNodeID) bool { return len(tree[id]) != 0 },
+		func(branch bool) fyne.CanvasObject { return widget.NewCheck("", nil) },
+		func(id widget.TreeNodeID, branch bool, o fyne.CanvasObject) {
+			c := o.(*widget.Check)
+			c.OnChanged = nil
+			c.Text = id[strings.LastIndex(id, keywordSep)+1:]
+			c.Checked = selected[id]
+			c.Refresh()
+			c.OnChanged = func(on bool) { selected[id] = on }
+		})
+	for _, k := range current {
+		for _, b := range ancestors(k) {
+			t.OpenBranch(b)
+		}
+	}
+	entry := widget.NewEntry()
+	entry.SetPlaceHolder("New keyword e.g Places|Australia|Sydney")
+	add := func() {
+		k, err := cleanKeyword(entry.Text)
+		if err != nil {
+			a.setStatus(err.Error())
+			return
+		}
+		if len(k) == 0 {
+			return
+		}
+		if !contains(keywordVocab, k) {
+			keywordVocab = append(keywordVocab, k)
+		}
+		tree.add(k)
+		selected[k] = true
+		for _, b := range ancestors(k) {
+			t.OpenBranch(b)
+		}
+		t.Refresh()
+		entry.SetText("")
+	}
+	entry.OnSubmitted = func(string) { a.locked(add) }
+	content := container.NewBorder(nil, container.NewBorder(nil, nil, nil, widget.NewButton("Add", func() { a.locked(add) }), entry), nil, nil, t)
+	d := dialog.NewCustomConfirm("Keywords: "+p.Name(), "Save", "Cancel", content, func(ok bool) {
+		a.lock.Lock()
+		defer a.lock.Unlock()
+		if !ok {
+			return
+		}
+		var kw []string
+		for k, on := range selected {
+			if on {
+				kw = append(kw, k)
+			}
+		}
+		sort.Strings(kw)
+		if err := p.SetKeywords(kw); err != nil {
+			a.setStatus(fmt.Sprintf("Failed to set keywords: %v", err))
+			return
+		}
+		a.showInfo()
+	}, a.win)
+	sz := a.win.Canvas().Size()
+	d.Resize(fyne.NewSize(sz.Width*0.5, sz.Height*0.7))
+	d.Show()
+}
@@ -0,0 +1,157 @@
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+// Captions in multiple languages, stored as XMP language alternatives.
+// Each field in another language is a separate field, numbered by adding
+// a multiple of langOffset to the field.
+// The headline cannot have languages, so in other languages the caption
+// bar edits the description, which most applications display as the caption.
+
+import (
+	"fmt"
+	"strings"
+
+	"fyne.io/fyne/v2/widget"
+)
+
+const (
+	defaultLang = "x-default" // Language of the default value
+	langOffset  = 1000        // Offset of the fields for each language
+)
+
+// The languages other than the default, from the -languages flag.
+var languages []string
+
+// parseLanguages sets the languages from a comma separated list.
+func parseLanguages(s string) {
+	for _, l := range strings.Split(s, ",") {
+		if l = strings.TrimSpace(l); len(l) != 0 && l != defaultLang {
+			languages = append(languages, l)
+		}
+	}
+}
+
+// langField returns the field for the language,
+// or the field itself if the language is not one of the languages.
+func langField(exiv int, lang string) int {
+	for i, l := range languages {
+		if l == lang {
+			return exiv + (i+1)*langOffset
+		}
+	}
+	return exiv
+}
+
+// splitField returns the field and language of a field.
+func splitField(field int) (int, string) {
+	i := field / langOffset
+	if i == 0 || i > len(languages) {
+		return field, defaultLang
+	}
+	return field % langOffset, languages[i-1]
+}
+
+// parseLangAlt splits the value of an XMP language alternative as
+// printed by exiv2, e.g lang="x-default" Some text, lang="de" Etwas Text
+// A value without a language qualifier is the default language.
+func parseLangAlt(value string) map[string]string {
+	alts := make(map[string]string)
+	if !strings.HasPrefix(value, `lang="`) {
+		if len(value) != 0 {
+			alts[defaultLang] = value
+		}
+		return alts
+	}
+	for _, a := range strings.Split(strings.TrimPrefix(value, `lang="`), `, lang="`) {
+		if lang, text, ok := strings.Cut(a, `" `); ok {
+			alts[lang] = text
+		} else {
+			alts[strings.TrimSuffix(a, `"`)] = ""
+		}
+	}
+	return alts
+}
+
+// formatLangAlt formats one value of a language alternative.
+func formatLangAlt(lang, value string) string {
+	return fmt.Sprintf(`lang="%s" %s`, lang, value)
+}
+
+// langOrder is used to sort the default language first.
+func langOrder(alt string) string {
+	if strings.HasPrefix(alt, formatLangAlt(defaultLang, "")) {
+		return ""
+	}
+	return alt
+}
+
+// captionField returns the field edited in the caption bar.
+func (a *Ptag) captionField() int {
+	if a.lang == defaultLang {
+		return EXIV_HEADLINE
+	}
+	return langField(EXIV_DESCRIPTION, a.lang)
+}
+
+// captionName names the field edited in the caption bar.
+func (a *Ptag) captionName() string {
+	if a.lang == defaultLang {
+		return "Headline"
+	}
+	return fmt.Sprintf("Description (%s)", a.lang)
+}
+
+// newLangSelect creates the language selector for the caption bar.
+func (a *Ptag) newLangSelect() *widget.Select {
+	opts := append([]string{defaultLang}, languages...)
+	s := widget.NewSelect(opts, nil)
+	s.SetSelectedIndex(0)
+	s.OnChanged = a.selectLanguage
+	return s
+}
+
+// selectLanguage is called when the language is selected from the selector.
+func (a *Ptag) selectLanguage(lang string) {
+	a.locked(func() { a.setLanguage(lang) })
+}
+
+// setLanguage changes the language being edited.
+func (a *Ptag) setLanguage(lang string) {
+	if lang == a.lang {
+		return
+	}
+	a.Sync()
+	a.lang = lang
+	// The selector is updated without calling selectLanguage,
+	// since the lock is already held.
+	a.langSelect.OnChanged = nil
+	a.langSelect.SetSelected(lang)
+	a.langSelect.OnChanged = a.selectLanguage
+	if len(a.picts) != 0 {
+		a.showCaption()
+		a.showSlideCaption()
+		a.setStatus("Caption bar edits the " + strings.ToLower(a.captionName()))
+	}
+}
+
+// nextLanguage cycles through the languages.
+func (a *Ptag) nextLanguage() {
+	opts := a.langSelect.Options
+	for i, l := range opts {
+		if l == a.lang {
+			a.setLanguage(opts[(i+1)%len(opts)])
+			return
+		}
+	}
+}
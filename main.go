@@ -17,6 +17,7 @@ import (
 	"fmt"
 	"os"
 	"runtime"
+	"time"
 )
 
 var verbose = flag.Bool("verbose", false, "Verbose tracing")
@@ -26,11 +27,92 @@ var maxPreload = flag.Int("preload", 10, "Maximum images to concurrently load")
 var width = flag.Int("width", 1200, "Window width") // These are fyne sizes, not pixels
 var height = flag.Int("height", 1000, "Window height")
 var sidecar = flag.Bool("sidecar", false, "Use sidecar file for EXIF")
+var keymap = flag.String("keymap", "", "File of key bindings")
+var fieldMap = flag.String("fields", "", "File mapping fields to EXIF tags")
+var templateFile = flag.String("templates", "", "File of caption templates")
+var langs = flag.String("languages", "", "Comma separated list of caption languages other than the default, in which the caption bar edits the description")
+var keywordFile = flag.String("keywords", "", "Keyword vocabulary file")
+var gpxFiles = flag.String("gpx", "", "Comma separated list of GPX track files for geotagging")
+var clockOffset = flag.Duration("clockoffset", 0, "Correction added to the camera time when geotagging e.g -1h if the camera clock is an hour fast")
+var maxGap = flag.Duration("maxgap", 5*time.Minute, "Maximum time from the nearest track point when geotagging")
+var geonames = flag.String("geonames", "", "GeoNames cities file (e.g cities500.txt) used to find place names")
+var stackGap = flag.Duration("stackgap", 2*time.Second, "Maximum time between the images of a stack")
+var dupDistance = flag.Int("dupdistance", 4, "Maximum difference (in bits) of the perceptual hashes of near duplicate images")
+var exportDir = flag.String("exportdir", "export", "Directory for exported images, relative to the image directory")
+var exportName = flag.String("exportname", "{name}", "Template for the names of exported images")
+var exportSize = flag.Int("exportsize", 2048, "Maximum width or height of exported images, 0 for the original size")
+var exportQuality = flag.Int("exportquality", 85, "JPEG quality of exported images")
+var exportStrip = flag.Bool("exportstrip", false, "Remove the metadata from exported images")
+var sheetCols = flag.Int("sheetcols", 5, "Number of columns on contact sheets")
+var sheetWidth = flag.Int("sheetwidth", 2480, "Width of contact sheets in pixels")
+var hover = flag.Bool("hover", false, "Edit the caption when the mouse is over it")
+var vocabFile = flag.String("vocab", "", "File of terms used for caption completion")
+var rejectDir = flag.String("rejects", "rejects", "Directory for rejected images, relative to the image directory")
+var picksDir = flag.String("picks", "picks", "Directory for picked images, relative to the image directory")
+var slideshow = flag.Bool("slideshow", false, "Start in slideshow mode")
+var delay = flag.Duration("delay", 5*time.Second, "Slideshow delay between images")
+var fade = flag.Duration("fade", 0, "Slideshow cross-fade time")
+var loop = flag.Bool("loop", false, "Restart slideshow after the last image")
+var shuffle = flag.Bool("shuffle", false, "Show slideshow images in random order")
+var slideCaption = flag.Bool("slidecaption", true, "Show captions during slideshow")
+
+// Commands that are run instead of displaying the images.
+var commands = map[string]func([]string) error{
+	"geotag":      geotagCmd,
+	"shift":       shiftCmd,
+	"dups":        dupsCmd,
+	"export":      exportCmd,
+	"gallery":     galleryCmd,
+	"sheet":       sheetCmd,
+	"export-meta": exportMetaCmd,
+	"import-meta": importMetaCmd,
+	"sync":        syncCmd,
+}
 
 func main() {
 	flag.Usage = usage
 	flag.Parse()
-
+	if len(*keymap) != 0 {
+		if err := readKeymap(*keymap); err != nil {
+			fmt.Fprintf(os.Stderr, "keymap: %v\n", err)
+			return
+		}
+	}
+	if len(*templateFile) != 0 {
+		if err := readTemplates(*templateFile); err != nil {
+			fmt.Fprintf(os.Stderr, "templates: %v\n", err)
+			return
+		}
+	}
+	if len(*vocabFile) != 0 {
+		if err := readVocabulary(*vocabFile); err != nil {
+			fmt.Fprintf(os.Stderr, "vocabulary: %v\n", err)
+			return
+		}
+	}
+	parseLanguages(*langs)
+	if len(*fieldMap) != 0 {
+		if err := readFieldMap(*fieldMap); err != nil {
+			fmt.Fprintf(os.Stderr, "fields: %v\n", err)
+			return
+		}
+	}
+	if len(*keywordFile) != 0 {
+		if err := readKeywords(*keywordFile); err != nil {
+			fmt.Fprintf(os.Stderr, "keywords: %v\n", err)
+			return
+		}
+	}
+	initExif()
+	// A file or directory with the same name as a command
+	// must be given as a path e.g ./export
+	if cmd, ok := commands[flag.Arg(0)]; ok {
+		if err := cmd(flag.Args()[1:]); err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", flag.Arg(0), err)
+			os.Exit(1)
+		}
+		return
+	}
 	var f []string
 	// No args, do all image files in the current directory
 	if len(flag.Args()) == 0 {
@@ -50,7 +132,6 @@ func main() {
 	if *verbose {
 		fmt.Printf("%d files in total, preload = %d\n", len(f), preload)
 	}
-	initExif()
 	a, err := newPtag(*width, *height, preload)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "init: %v", err)
@@ -62,18 +143,81 @@ func main() {
 func usage() {
 	fmt.Fprintf(os.Stderr, "Usage of %s:\n", os.Args[0])
 	flag.PrintDefaults()
+	fmt.Fprintf(os.Stderr, "\nShortcut keys are:\n%s", keyHelp())
+	fmt.Fprintf(os.Stderr, `
+The key bindings may be changed using a key map file, where each line is:
+  <action> <key> ...
+Any action, or any image, can also be selected from the command palette.
+The actions are:
+`)
+	for _, act := range actions {
+		fmt.Fprintf(os.Stderr, "  %-16s %s\n", act.id, act.name)
+	}
 	fmt.Fprintf(os.Stderr, `
-Shortcut keys are:
-  'N' <right-arrow> <space>        Next image
-  'P' <left-arrow> <back-space>    Previous image
-  <Home>                           First image
-  <End>                            Last image
-  <down-arrow>                     Jump forward 10 images
-  <up-arrow>                       Jump back 10 images
-  -, 0, 1, 2, 3, 4, 5              Set the EXIF rating to this value [- delete]
-  'F'                              Toggle full-screen
-  'R'                              Rotate right 90 degrees
-  'M'                              Mirror flip the image
-  'Q'                              Quit
+The fields file maps the fields (rating, headline, title, description, label,
+orientation, keywords, subject, city, state and country) to the EXIF tags that
+are read or written, where each line is:
+  <field> read <tag> ...
+  <field> write <tag> ...
+A field is read from the first tag with a value, and written to all the tags.
+
+The caption bar edits the headline. The headline has no languages, so when
+one of the -languages is selected the caption bar edits the description in
+that language instead, as do the caption templates and the contact sheets.
+The describe dialog edits the title and description in the selected language.
+
+The templates file contains one caption template per line, which are applied
+from the command palette. Templates may contain the variables:
+  {date} {time} {filename} {name} {seq} {camera}
+
+Instead of displaying the images, a command may be given after the flags.
+The first argument is always taken as a command if it is a command name, so
+a file or directory with the same name (such as the default -exportdir) must
+be given as a path e.g ./export
+  geotag [-n] [track.gpx ...] image ...
+    Set the GPS position of the images from the GPX tracks and the -gpx files,
+    using -clockoffset and -maxgap. -n reports the matches without writing them.
+  shift [-n] -offset <duration> image ...
+  shift [-n] -ref <image> -time "YYYY-MM-DD HH:MM:SS"|-to <image> image ...
+    Shift the capture time of the images by the offset, or by the difference
+    between the reference image and its correct time, or an image taken at the
+    same moment by a camera with a correct clock. -n reports the new times.
+  dups image ...
+    List the groups of identical and similar images, using -dupdistance.
+  export [-o dir] [-name template] [-size n] [-quality n] [-strip] [-rating n] image ...
+    Export the images (with at least the rating) as resized JPEGs, with the
+    orientation applied. The defaults are set by the -export flags, and the
+    name is a caption template. Characters that cannot be used in file names,
+    such as the : in {time}, are replaced by _. Images with the same name are
+    given a -2, -3 etc suffix.
+  gallery [-o dir] [-title title] [-size n] [-quality n] [-strip] [-rating n] image ...
+    Build a static HTML gallery of the images (with at least the rating), with
+    thumbnails, the headlines as captions, and the ratings.
+  sheet [-o file] [-cols n] [-width n] [-rating n] image ...
+    Write a contact sheet of the images (with at least the rating), with the
+    name, rating and headline under each image. The file is a PDF of A4 pages,
+    or a single JPEG sheet.
+  export-meta [-o file] image ...
+    Write the path, rating, caption (headline), orientation, label and keywords
+    of the images to a .csv or .json file (- for CSV on the standard output).
+    The paths are relative to the directory of the file.
+  import-meta [-n] [-f] file
+    List the changes in an edited metadata file, and apply them. Only the
+    columns present are changed, and an empty value deletes the field.
+    Relative paths are relative to the directory of the file.
+    -n lists the changes without making them. Invalid values are reported, and
+    no changes are made unless -f is given.
+  sync [-n] [-stores a,b] [-policy newer|embedded|merge|mirror] [-to store] image ...
+    Sync the metadata between two of the stores: embedded, sidecar (the .exif
+    file) and xmp (an XMP sidecar). A field set in only one store is copied to
+    the other, and different values are resolved by the policy: the newer
+    file, the embedded (or first) store, or merging lists such as keywords.
+    mirror makes the other store the same as the newer file, deleting the
+    fields missing from it, so that deletions are synced (except for the
+    shooting dates). -to only changes that store, to migrate to it. -n
+    reports the changes.
+
+The keywords file is a Lightroom keyword export (one keyword per line, each
+level indented by a tab), or a list of keyword paths e.g Places|Australia|Sydney.
 `)
 }
@@ -0,0 +1,382 @@
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+// Exporting and importing metadata as CSV or JSON, so that it can be
+// edited in other tools such as spreadsheets.
+// The format is selected by the file extension. A CSV file has a header
+// row naming the columns, and the keywords are separated by commas.
+// A JSON file is a list of objects, with the rating as a number and
+// the keywords as a list. When importing, only the columns (or keys)
+// that are present are changed, and an empty value deletes the field.
+// Relative paths are relative to the directory of the metadata file.
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// UTF-8 byte order mark.
+const utf8BOM = "\ufeff"
+
+// The metadata columns, after the path.
+var metaColumns = []struct {
+	name string
+	tag  int
+}{
+	{"rating", EXIV_RATING},
+	{"caption", EXIV_HEADLINE},
+	{"orientation", EXIV_ORIENTATION},
+	{"label", EXIV_LABEL},
+	{"keywords", EXIV_KEYWORDS},
+}
+
+// metaFormat returns the format of the file from its extension.
+func metaFormat(file string) (string, error) {
+	switch ext := strings.ToLower(filepath.Ext(file)); ext {
+	case ".csv", ".json":
+		return ext[1:], nil
+	}
+	return "", fmt.Errorf("%s: metadata file must be a .csv or .json file", file)
+}
+
+// readMeta returns the metadata of the image, keyed by column name.
+func readMeta(p *Pict) (map[string]string, error) {
+	if err := p.ready(); err != nil {
+		return nil, err
+	}
+	m := make(map[string]string)
+	for _, c := range metaColumns {
+		m[c.name], _ = p.getExif(c.tag)
+	}
+	return m, nil
+}
+
+// metaPath returns the path of the image relative to the directory,
+// or the absolute path if there is no relative path.
+func metaPath(file, dir string) string {
+	abs, err := filepath.Abs(file)
+	if err != nil {
+		return file
+	}
+	if rel, err := filepath.Rel(dir, abs); err == nil {
+		return rel
+	}
+	return abs
+}
+
+// writeMeta writes the metadata of the images as CSV or JSON, with
+// the paths relative to the directory.
+func writeMeta(w io.Writer, format string, picts []*Pict, dir string) error {
+	var rows []map[string]string
+	for _, p := range picts {
+		m, err := readMeta(p)
+		if err != nil {
+			return fmt.Errorf("%s: %v", p.Path(), err)
+		}
+		m["path"] = metaPath(p.Path(), dir)
+		rows = append(rows, m)
+	}
+	if format == "json" {
+		var objs []map[string]any
+		for _, m := range rows {
+			obj := map[string]any{"path": m["path"]}
+			for _, c := range metaColumns {
+				obj[c.name] = m[c.name]
+			}
+			obj["rating"] = nil
+			if r, err := strconv.Atoi(m["rating"]); err == nil {
+				obj["rating"] = r
+			}
+			obj["keywords"] = append([]string{}, splitList(m["keywords"])...)
+			objs = append(objs, obj)
+		}
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(objs)
+	}
+	cw := csv.NewWriter(w)
+	header := []string{"path"}
+	for _, c := range metaColumns {
+		header = append(header, c.name)
+	}
+	cw.Write(header)
+	for _, m := range rows {
+		var rec []string
+		for _, h := range header {
+			rec = append(rec, m[h])
+		}
+		cw.Write(rec)
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// parseMeta reads the metadata rows from a CSV or JSON file. Each row
+// only has the columns that are present in the file.
+func parseMeta(r io.Reader, format string) ([]map[string]string, error) {
+	var rows []map[string]string
+	// Spreadsheets such as Excel start UTF-8 files with a byte order mark,
+	// which would otherwise be part of the first column name.
+	br := bufio.NewReader(r)
+	if b, err := br.Peek(len(utf8BOM)); err == nil && string(b) == utf8BOM {
+		br.Discard(len(utf8BOM))
+	}
+	r = br
+	if format == "json" {
+		var objs []map[string]any
+		if err := json.NewDecoder(r).Decode(&objs); err != nil {
+			return nil, err
+		}
+		for i, obj := range objs {
+			m := make(map[string]string)
+			for k, v := range obj {
+				switch v := v.(type) {
+				case nil:
+					m[k] = ""
+				case string:
+					m[k] = v
+				case float64:
+					m[k] = strconv.FormatFloat(v, 'f', -1, 64)
+				case []any:
+					var l []string
+					for _, item := range v {
+						s, ok := item.(string)
+						if !ok {
+							return nil, fmt.Errorf("entry %d: %s: illegal list item", i+1, k)
+						}
+						// The items are joined with commas, so an item cannot contain one.
+						if strings.Contains(s, ",") {
+							return nil, fmt.Errorf("entry %d: %s: item cannot contain a comma (%s)", i+1, k, s)
+						}
+						l = append(l, s)
+					}
+					m[k] = joinList(l)
+				default:
+					return nil, fmt.Errorf("entry %d: %s: illegal value", i+1, k)
+				}
+			}
+			rows = append(rows, m)
+		}
+		return rows, nil
+	}
+	cr := csv.NewReader(r)
+	recs, err := cr.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(recs) == 0 {
+		return nil, nil
+	}
+	header := recs[0]
+	for _, rec := range recs[1:] {
+		m := make(map[string]string)
+		for i, h := range header {
+			m[strings.ToLower(strings.TrimSpace(h))] = rec[i]
+		}
+		rows = append(rows, m)
+	}
+	return rows, nil
+}
+
+// diffMeta validates the rows and compares them with the images,
+// returning the changes. Values are validated using the same rules as
+// when the metadata is read, and rows with errors are reported and skipped.
+// Relative paths are relative to the directory.
+func diffMeta(rows []map[string]string, dir string) ([]metaChange, int) {
+	var changes []metaChange
+	errors := 0
+	for i, m := range rows {
+		path := strings.TrimSpace(m["path"])
+		if len(path) == 0 {
+			fmt.Fprintf(os.Stderr, "row %d: no path\n", i+1)
+			errors++
+			continue
+		}
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(dir, path)
+		}
+		p := NewPict(path, i)
+		cur, err := readMeta(p)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", path, err)
+			errors++
+			continue
+		}
+		var c []metaChange
+		ok := true
+		for _, col := range metaColumns {
+			v, present := m[col.name]
+			if !present {
+				continue
+			}
+			// Spaces are kept in the caption, since they may be intended.
+			if col.tag != EXIV_HEADLINE {
+				v = strings.TrimSpace(v)
+			}
+			if col.tag == EXIV_KEYWORDS {
+				// The keywords are separated by commas, with or without spaces.
+				var kw []string
+				for _, k := range strings.Split(v, ",") {
+					k, err := cleanKeyword(k)
+					if err != nil {
+						fmt.Fprintf(os.Stderr, "%s: %v\n", path, err)
+						ok = false
+						break
+					}
+					if len(k) != 0 {
+						kw = append(kw, k)
+					}
+				}
+				if !ok {
+					break
+				}
+				v = joinList(kw)
+			}
+			if len(v) != 0 {
+				if v, ok = validate(path, col.tag, v); !ok {
+					break
+				}
+			}
+			if v != cur[col.name] {
+				c = append(c, metaChange{p, col.name, col.tag, cur[col.name], v})
+			}
+		}
+		if !ok {
+			errors++
+			continue
+		}
+		changes = append(changes, c...)
+	}
+	return changes, errors
+}
+
+// apply makes the change to the image.
+func (c metaChange) apply() error {
+	switch c.tag {
+	case EXIV_RATING:
+		r := -1
+		if len(c.new) != 0 {
+			r, _ = strconv.Atoi(c.new)
+		}
+		return c.p.SetRating(r)
+	case EXIV_ORIENTATION:
+		return c.p.SetOrientation(c.new)
+	case EXIV_LABEL:
+		return c.p.SetLabel(c.new)
+	case EXIV_KEYWORDS:
+		return c.p.SetKeywords(splitList(c.new))
+	}
+	return c.p.SetField(c.tag, c.new)
+}
+
+// exportMetaCmd writes the metadata of the images on the command line.
+func exportMetaCmd(args []string) error {
+	fs := flag.NewFlagSet("export-meta", flag.ExitOnError)
+	out := fs.String("o", "metadata.csv", "Output file (.csv or .json), or - for CSV on the standard output")
+	fs.Parse(args)
+	files := expand(fs.Args())
+	if len(files) == 0 {
+		return fmt.Errorf("no images")
+	}
+	var picts []*Pict
+	for i, f := range files {
+		picts = append(picts, NewPict(f, i))
+	}
+	if *out == "-" {
+		cwd, err := os.Getwd()
+		if err != nil {
+			return err
+		}
+		return writeMeta(os.Stdout, "csv", picts, cwd)
+	}
+	format, err := metaFormat(*out)
+	if err != nil {
+		return err
+	}
+	dir, err := filepath.Abs(filepath.Dir(*out))
+	if err != nil {
+		return err
+	}
+	f, err := os.Create(*out)
+	if err != nil {
+		return err
+	}
+	err = writeMeta(f, format, picts, dir)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		fmt.Printf("Metadata of %d images written to %s\n", len(picts), *out)
+	}
+	return err
+}
+
+// importMetaCmd applies the metadata in a CSV or JSON file to the images,
+// after listing the changes.
+func importMetaCmd(args []string) error {
+	fs := flag.NewFlagSet("import-meta", flag.ExitOnError)
+	dryRun := fs.Bool("n", false, "List the changes without making them")
+	force := fs.Bool("f", false, "Apply the valid rows even if some rows have errors")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		return fmt.Errorf("one metadata file required")
+	}
+	format, err := metaFormat(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	f, err := os.Open(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	rows, err := parseMeta(f, format)
+	f.Close()
+	if err != nil {
+		return fmt.Errorf("%s: %v", fs.Arg(0), err)
+	}
+	changes, errors := diffMeta(rows, filepath.Dir(fs.Arg(0)))
+	for _, c := range changes {
+		fmt.Printf("%s: %s %q -> %q\n", c.p.Path(), c.column, c.old, c.new)
+	}
+	fmt.Printf("%d changes", len(changes))
+	if errors != 0 {
+		fmt.Printf(", %d rows with errors", errors)
+	}
+	fmt.Println()
+	if *dryRun || len(changes) == 0 {
+		return nil
+	}
+	if errors != 0 && !*force {
+		return fmt.Errorf("no changes made (use -f to apply the valid rows)")
+	}
+	failed := 0
+	for _, c := range changes {
+		if err := c.apply(); err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", c.p.Path(), err)
+			failed++
+		}
+	}
+	if failed != 0 {
+		return fmt.Errorf("%d changes failed", failed)
+	}
+	return nil
+}
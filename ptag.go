@@ -39,7 +39,7 @@ func newPtag(width, height, preload int) (*Ptag, error) {
 	} else {
 		win.Resize(fyne.NewSize(float32(width), float32(height)))
 	}
-	return &Ptag{app: a, win: win, preload: preload, loaded: map[int]nothing{}}, nil
+	return &Ptag{app: a, win: win, preload: preload, loaded: map[int]nothing{}, keys: keyMap(), slideshow: newSlideshow(), info: newInfoOverlay(), histo: newHistogramOverlay(), progress: newProgress(), completer: newCompleter(), lang: defaultLang}, nil
 }
 
 // start initialises the app and starts it.
@@ -51,9 +51,14 @@ func (a *Ptag) start(f []string) {
 	a.build()
 	// Create a Pict object for every image
 	for i, file := range f {
-		p := NewPict(file, i)
-		p.SetTitle(fmt.Sprintf("%s (%d/%d)", p.Path(), i+1, len(f)))
-		a.picts = append(a.picts, p)
+		a.all = append(a.all, NewPict(file, i))
+	}
+	a.picts = a.all
+	a.retitle()
+	go a.scanCaptions(a.all)
+	// The place names are read in the background, since the file is large.
+	if len(*geonames) != 0 {
+		loadGazetteer()
 	}
 	// Show the main window.
 	a.win.Show()
@@ -62,11 +67,24 @@ func (a *Ptag) start(f []string) {
 	a.app.Run()
 }
 
+// locked runs f with the display state locked.
+// The display state (the images, the current index, the cache and the
+// overlays) is changed from the UI and from background goroutines, so
+// the UI event handlers and the background goroutines hold the lock while
+// making changes. Functions called with the lock held must not lock it again.
+func (a *Ptag) locked(f func()) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	f()
+}
+
 // Show the current image.
 func (a *Ptag) show() {
 	p := a.picts[a.index]
 	defer a.win.SetTitle(p.Title())
-	if err := p.Draw(a.iDraw); err != nil {
+	if a.compare != nil {
+		a.showCompare()
+	} else if err := p.Draw(a.iDraw); err != nil {
 		fmt.Fprintf(os.Stderr, "%s: draw: %v", p.Name(), err)
 		return
 	}
@@ -74,23 +92,18 @@ func (a *Ptag) show() {
 	if *verbose {
 		fmt.Printf("%s (%d): Showing image, size %g, %g\n", p.Name(), a.index, a.iCanvas.Size().Width, a.iCanvas.Size().Height)
 	}
-	// If Draw worked, no error will be returned from Caption()
-	capt, _ := p.Caption()
-	if len(capt) != 0 {
-		if *verbose {
-			fmt.Printf("Initialising caption text to <%s>\n", capt)
-		}
-		a.caption.SetText(capt)
-	} else {
-		a.caption.SetText("")
-		a.caption.SetPlaceHolder("Caption")
-	}
+	a.showCaption()
 	a.displayRating()
+	a.showSlideCaption()
+	a.showInfo()
+	a.showHistogram()
 }
 
 // build creates the elements that comprise the main window.
 func (a *Ptag) build() {
 	a.rating = canvas.NewText("Rating: -", color.Black)
+	a.marks = canvas.NewText("", color.NRGBA{200, 0, 0, 255})
+	a.dirty = canvas.NewText("", color.NRGBA{200, 0, 0, 255})
 	a.caption = &CaptionEntry{app: a}
 	a.caption.ExtendBaseWidget(a.caption)
 	a.caption.SetPlaceHolder("Caption")
@@ -100,51 +113,17 @@ func (a *Ptag) build() {
 	// The resize watcher will detect when the window is
 	// shown so that the first image can be loaded.
 	a.iCanvas = canvas.NewRectangle(color.Black)
-	a.top = container.NewBorder(nil, nil, a.rating, nil, a.caption)
-	a.win.SetContent(container.NewBorder(a.top, nil, nil, nil, a.iCanvas))
+	right := container.NewHBox(a.dirty)
+	a.langSelect = a.newLangSelect()
+	if len(languages) != 0 {
+		right.Add(a.langSelect)
+	}
+	a.top = container.NewBorder(nil, nil, container.NewHBox(a.rating, a.marks), right, a.caption)
+	a.overlay = container.NewBorder(container.NewVBox(a.completer.box, a.progress.box), a.slideshow.overlay, a.info.box, a.histo.box)
+	a.setContent()
 	// Add key handlers
 	if deskCanvas, ok := a.win.Canvas().(desktop.Canvas); ok {
-		deskCanvas.SetOnKeyDown(func(key *fyne.KeyEvent) {
-			if *verbose {
-				fmt.Printf("Key: %s\n", key.Name)
-			}
-			switch key.Name {
-			case fyne.KeyUp, fyne.KeyPageUp:
-				a.setIndex(a.index - 10)
-			case fyne.KeyDown, fyne.KeyPageDown:
-				a.setIndex(a.index + 10)
-			case "N", fyne.KeyRight, fyne.KeySpace:
-				a.setIndex(a.index + 1)
-			case "P", fyne.KeyLeft, fyne.KeyBackspace:
-				a.setIndex(a.index - 1)
-			case fyne.KeyHome:
-				a.setIndex(0)
-			case fyne.KeyEnd:
-				a.setIndex(len(a.picts) - 1)
-			case "M":
-				a.mirror()
-			case "R":
-				a.rotate()
-			case "F":
-				a.fullScreen()
-			case "Q":
-				a.quit()
-			case fyne.KeyMinus:
-				a.rate(-1)
-			case fyne.Key0:
-				a.rate(0)
-			case fyne.Key1:
-				a.rate(1)
-			case fyne.Key2:
-				a.rate(2)
-			case fyne.Key3:
-				a.rate(3)
-			case fyne.Key4:
-				a.rate(4)
-			case fyne.Key5:
-				a.rate(5)
-			}
-		})
+		deskCanvas.SetOnKeyDown(a.keyDown)
 	}
 }
 
@@ -162,18 +141,38 @@ func (a *Ptag) Sync() {
 	if a.updated {
 		a.updated = false
 		p := a.picts[a.index]
-		c, err := p.Caption()
+		c, err := p.Field(a.captionField())
 		if err == nil {
 			if c != a.caption.Text {
 				if *verbose {
 					fmt.Printf("%s (%d): update caption to <%s>\n", p.Name(), a.index, a.caption.Text)
 				}
-				p.SetCaption(a.caption.Text)
+				p.SetField(a.captionField(), a.caption.Text)
+				a.completer.addCaption(a.caption.Text)
 			}
 		}
+		a.showDirty()
 	}
 }
 
+// showCaption sets the caption bar from the current image.
+func (a *Ptag) showCaption() {
+	// If Draw worked, no error will be returned from Field()
+	capt, _ := a.picts[a.index].Field(a.captionField())
+	a.completer.box.Hide()
+	a.completer.quiet = true
+	defer func() { a.completer.quiet = false }()
+	if len(capt) != 0 {
+		if *verbose {
+			fmt.Printf("Initialising caption text to <%s>\n", capt)
+		}
+		a.caption.SetText(capt)
+	} else {
+		a.caption.SetText("")
+	}
+	a.caption.SetPlaceHolder(a.captionName())
+}
+
 // Window has been resized, so rescale all the images and redisplay the current one.
 func (a *Ptag) resize() {
 	sz := a.iCanvas.Size()
@@ -186,18 +185,26 @@ func (a *Ptag) resize() {
 	// This canvas is then used as the target for the image drawing.
 	a.iDraw = image.NewRGBA(image.Rect(0, 0, int(sz.Width*scale), int(sz.Height*scale)))
 	a.iCanvas = canvas.NewRasterFromImage(a.iDraw)
-	a.win.SetContent(container.NewBorder(a.top, nil, nil, nil, a.iCanvas))
+	a.setContent()
 	// The first image to be displayed shows the window.
 	if !a.active {
 		a.active = true
 		// Preload other images
 		defer a.cacheUpdate()
+		if *slideshow {
+			defer a.toggleSlideshow()
+		}
 	} else {
 		a.flushCache()
 	}
 	a.redisplay()
 }
 
+// setContent sets the window content, with the overlay displayed on top of the image.
+func (a *Ptag) setContent() {
+	a.win.SetContent(container.NewBorder(a.top, nil, nil, nil, container.NewStack(a.iCanvas, a.overlay)))
+}
+
 // fullScreen toggles full screen mode
 func (a *Ptag) fullScreen() {
 	a.win.SetFullScreen(!a.win.FullScreen())
@@ -210,50 +217,50 @@ func (a *Ptag) quit() {
 	a.app.Quit()
 }
 
+// Orientation changes when the image is rotated 90 degrees clockwise.
+var rotateRight = map[string]string{
+	"":  "6", // No existing orientation
+	"1": "6",
+	"2": "5",
+	"3": "8",
+	"4": "7",
+	"5": "4",
+	"6": "3",
+	"7": "2",
+	"8": "1"}
+
+// Orientation changes when the image is mirror flipped.
+var mirrorFlip = map[string]string{
+	"":  "2", // No existing orientation
+	"1": "2",
+	"2": "1",
+	"3": "4",
+	"4": "3",
+	"5": "6",
+	"6": "5",
+	"7": "8",
+	"8": "7"}
+
 // rotate the image 90 degrees clockwise
 func (a *Ptag) rotate() {
-	a.adjustOrientation(map[string]string{
-		"":  "6", // No existing orientation
-		"1": "6",
-		"2": "5",
-		"3": "8",
-		"4": "7",
-		"5": "4",
-		"6": "3",
-		"7": "2",
-		"8": "1"})
+	a.adjustOrientation(rotateRight)
 }
 
 // mirror the image
 func (a *Ptag) mirror() {
-	a.adjustOrientation(map[string]string{
-		"":  "2", // No existing orientation
-		"1": "2",
-		"2": "1",
-		"3": "4",
-		"4": "3",
-		"5": "6",
-		"6": "5",
-		"7": "8",
-		"8": "7"})
+	a.adjustOrientation(mirrorFlip)
 }
 
 // adjustOrientation selects a new orientation value using
 // the current orientation as the key.
 func (a *Ptag) adjustOrientation(adj map[string]string) {
 	p := a.picts[a.index]
-	if current, err := p.Orientation(); err != nil {
-		fmt.Fprintf(os.Stderr, "%s: current orientation: %v", p.Name(), err)
+	if current, newO, err := p.AdjustOrientation(adj); err != nil {
+		fmt.Fprintf(os.Stderr, "%s: orientation: %v", p.Name(), err)
 	} else {
-		newO, ok := adj[current]
-		if !ok {
-			fmt.Fprintf(os.Stderr, "%s: unknown orientation: %s", p.Name(), current)
-		} else {
-			p.SetOrientation(newO)
-			a.redisplay()
-			if *verbose {
-				fmt.Printf("%s: old orientation %s, new orientation: %s\n", p.Name(), current, newO)
-			}
+		a.redisplay()
+		if *verbose {
+			fmt.Printf("%s: old orientation %s, new orientation: %s\n", p.Name(), current, newO)
 		}
 	}
 }
@@ -265,6 +272,7 @@ func (a *Ptag) rate(rating int) {
 		fmt.Fprintf(os.Stderr, "%s: Failed to set rating: %v", p.Name(), err)
 	} else {
 		a.displayRating()
+		a.restack()
 	}
 }
 
@@ -284,7 +292,14 @@ func (a *Ptag) displayRating() {
 	} else {
 		a.rating.Text = fmt.Sprintf("Rating: %d", rating)
 	}
+	if label, _ := p.Label(); len(label) != 0 {
+		a.rating.Text += fmt.Sprintf("  Label: %s", label)
+	}
 	a.rating.Refresh()
+	a.displayMarks()
+	if a.compare != nil {
+		a.compareLabels()
+	}
 }
 
 // redisplay the current image, usually because something has changed
@@ -294,6 +309,16 @@ func (a *Ptag) redisplay() {
 	a.setIndex(a.index)
 }
 
+// move steps forward or back through the images.
+// In compare mode, the candidates are stepped instead.
+func (a *Ptag) move(delta int) {
+	if a.compare != nil {
+		a.compareStep(delta)
+	} else {
+		a.setIndex(a.index + delta)
+	}
+}
+
 // setIndex selects the image to display.
 func (a *Ptag) setIndex(newIndex int) {
 	a.Sync()
@@ -304,6 +329,9 @@ func (a *Ptag) setIndex(newIndex int) {
 		newIndex = len(a.picts) - 1
 	}
 	a.index = newIndex
+	if a.compare != nil {
+		a.setPanel(a.index)
+	}
 	a.addCache(a.index)
 	a.show()
 	a.cacheUpdate()
@@ -340,6 +368,15 @@ func (a *Ptag) cacheUpdate() {
 		before--
 		after++
 	}
+	// Keep the images being compared.
+	if a.compare != nil {
+		for _, index := range a.compare.panels {
+			if _, ok := a.loaded[index]; !ok {
+				newEntries = append(newEntries, index)
+			}
+			nc[index] = nothing{}
+		}
+	}
 	// Unload any items not in the new cache
 	for k, _ := range a.loaded {
 		if _, ok := nc[k]; !ok {
@@ -371,34 +408,47 @@ func (a *Ptag) removeCache(index int) {
 func (a *Ptag) addCache(index int) {
 	if _, ok := a.loaded[index]; !ok {
 		a.loaded[index] = nothing{}
-		a.picts[index].StartLoad(a.iDraw.Bounds().Max.X, a.iDraw.Bounds().Max.Y)
+		w, h := a.loadSize()
+		a.picts[index].StartLoad(w, h)
 	}
 }
 
+// loadSize returns the size that images are scaled to.
+func (a *Ptag) loadSize() (int, int) {
+	b := a.iDraw.Bounds()
+	if a.compare != nil {
+		b = a.compare.panelRects(b)[0]
+	}
+	return b.Dx(), b.Dy()
+}
+
 // resizeWatcher tracks the actual size of the image canvas,
 // and will force the images to be resized and redisplayed once
 // the window has been resized.
 func (a *Ptag) resizeWatcher() {
 	sl := time.Millisecond * 50
 	changed := 0
-	lastC := a.iCanvas.Size()
+	var lastC fyne.Size
+	a.locked(func() { lastC = a.iCanvas.Size() })
 	current := lastC
 	for {
 		time.Sleep(sl)
-		if a.iCanvas.Size() != lastC {
-			lastC = a.iCanvas.Size()
-			// 250 ms delay before actioning resize
-			changed = 5
-		}
-		if changed != 0 {
-			changed--
-			if changed == 0 {
-				if *verbose {
-					fmt.Printf("Canvas resize to %g, %g from %g, %g\n", a.iCanvas.Size().Width, a.iCanvas.Size().Height, current.Width, current.Height)
+		a.locked(func() {
+			if a.iCanvas.Size() != lastC {
+				lastC = a.iCanvas.Size()
+				// 250 ms delay before actioning resize
+				changed = 5
+			}
+			if changed != 0 {
+				changed--
+				if changed == 0 {
+					if *verbose {
+						fmt.Printf("Canvas resize to %g, %g from %g, %g\n", a.iCanvas.Size().Width, a.iCanvas.Size().Height, current.Width, current.Height)
+					}
+					a.resize()
+					current = lastC
 				}
-				a.resize()
-				current = lastC
 			}
-		}
+		})
 	}
 }
@@ -0,0 +1,173 @@
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+// Shifting the capture time of images taken with a wrong camera clock.
+// The offset is either given directly, or is the difference between
+// the capture time of a reference image and its correct time.
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+)
+
+// Format used to display and enter times.
+const displayTimeFormat = "2006-01-02 15:04:05"
+
+// captureTime returns the capture time of the image. Since the time has
+// no zone, it is returned as UTC.
+func captureTime(p *Pict) (time.Time, error) {
+	date, err := p.Date(EXIV_DATE)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if len(date) == 0 {
+		return time.Time{}, fmt.Errorf("%s: no capture time", p.Name())
+	}
+	return time.Parse(exifTimeFormat, date)
+}
+
+// shiftCmd shifts the capture time of the images on the command line.
+func shiftCmd(args []string) error {
+	fs := flag.NewFlagSet("shift", flag.ExitOnError)
+	offset := fs.Duration("offset", 0, "Offset added to the capture time")
+	ref := fs.String("ref", "", "Reference image used to calculate the offset")
+	at := fs.String("time", "", "Correct time of the reference image (YYYY-MM-DD HH:MM:SS)")
+	to := fs.String("to", "", "Image taken at the same time as the reference image, with a correct clock")
+	dryRun := fs.Bool("n", false, "Report the new times without changing them")
+	fs.Parse(args)
+	if len(*ref) != 0 {
+		r, err := captureTime(NewPict(*ref, 0))
+		if err != nil {
+			return err
+		}
+		var correct time.Time
+		switch {
+		case len(*at) != 0:
+			if correct, err = time.Parse(displayTimeFormat, *at); err != nil {
+				return err
+			}
+		case len(*to) != 0:
+			if correct, err = captureTime(NewPict(*to, 0)); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("-ref requires -time or -to")
+		}
+		*offset = correct.Sub(r)
+	}
+	if *offset == 0 {
+		return fmt.Errorf("no offset")
+	}
+	images := expand(fs.Args())
+	if len(images) == 0 {
+		return fmt.Errorf("no images")
+	}
+	fmt.Printf("Shifting by %v\n", *offset)
+	failed := 0
+	for i, f := range images {
+		p := NewPict(f, i)
+		t, err := captureTime(p)
+		if err == nil {
+			fmt.Printf("%-20s %s -> %s\n", p.Name(), t.Format(displayTimeFormat), t.Add(*offset).Format(displayTimeFormat))
+			if !*dryRun {
+				err = p.ShiftTime(*offset)
+			}
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", p.Name(), err)
+			failed++
+		}
+	}
+	if failed != 0 {
+		return fmt.Errorf("%d images failed", failed)
+	}
+	return nil
+}
+
+// shiftTime asks for the offset, and shifts the capture time of the marked images.
+// The offset can also be set by entering the correct time of the current image.
+func (a *Ptag) shiftTime() {
+	m := a.marked()
+	if len(m) == 0 {
+		a.setStatus("No images marked")
+		return
+	}
+	ref := a.picts[a.index]
+	offset := widget.NewEntry()
+	offset.SetPlaceHolder("e.g -1h or 59m30s")
+	correct := widget.NewEntry()
+	correct.SetPlaceHolder("YYYY-MM-DD HH:MM:SS")
+	r, err := captureTime(ref)
+	if err == nil {
+		correct.SetText(r.Format(displayTimeFormat))
+		correct.OnChanged = func(s string) {
+			if t, err := time.Parse(displayTimeFormat, s); err == nil {
+				offset.SetText(t.Sub(r).String())
+			}
+		}
+	} else {
+		correct.Disable()
+	}
+	items := []*widget.FormItem{
+		widget.NewFormItem("Offset", offset),
+		widget.NewFormItem("Time of "+ref.Name(), correct),
+	}
+	dialog.ShowForm("Shift time of marked images", "Shift", "Cancel", items, func(ok bool) {
+		a.lock.Lock()
+		defer a.lock.Unlock()
+		if !ok {
+			return
+		}
+		d, err := time.ParseDuration(offset.Text)
+		if err != nil || d == 0 {
+			a.setStatus(fmt.Sprintf("Illegal offset (%s)", offset.Text))
+			return
+		}
+		a.shiftPicts(m, d, true)
+	}, a.win)
+}
+
+// shiftPicts shifts the capture time of the images. If undo is set,
+// an undo action is added that shifts the images back.
+func (a *Ptag) shiftPicts(m []*Pict, offset time.Duration, undo bool) bool {
+	var lock sync.Mutex
+	var shifted []*Pict
+	name := fmt.Sprintf("Shift time by %v", offset)
+	if !a.runBatch(name, m, false, func(p *Pict) error {
+		if err := p.ShiftTime(offset); err != nil {
+			return err
+		}
+		lock.Lock()
+		shifted = append(shifted, p)
+		lock.Unlock()
+		return nil
+	}, nil) {
+		return false
+	}
+	if undo {
+		a.pushUndo(fmt.Sprintf("time shift by %v", offset), func() error {
+			if !a.shiftPicts(shifted, -offset, false) {
+				return fmt.Errorf("batch operation running")
+			}
+			return nil
+		})
+	}
+	return true
+}
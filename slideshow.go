@@ -0,0 +1,267 @@
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+// Slideshow mode, which automatically steps through the images.
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"math/rand"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/canvas"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/theme"
+)
+
+// Number of steps in a cross-fade transition.
+const fadeSteps = 10
+
+// newSlideshow creates the slideshow settings and the caption overlay.
+func newSlideshow() *Slideshow {
+	s := &Slideshow{delay: *delay, fade: *fade, loop: *loop, shuffle: *shuffle, caption: *slideCaption}
+	s.text = canvas.NewText("", color.White)
+	s.text.Alignment = fyne.TextAlignCenter
+	s.text.TextSize = theme.TextSize() * 2
+	s.overlay = container.NewStack(canvas.NewRectangle(color.NRGBA{0, 0, 0, 160}), container.NewPadded(s.text))
+	s.overlay.Hide()
+	return s
+}
+
+// toggleSlideshow starts or stops the slideshow.
+func (a *Ptag) toggleSlideshow() {
+	s := a.slideshow
+	if s.stop != nil {
+		close(s.stop)
+		s.stop = nil
+		a.showSlideCaption()
+		if *verbose {
+			fmt.Printf("Slideshow stopped\n")
+		}
+		return
+	}
+	s.paused = false
+	s.makeOrder(a.index, len(a.picts))
+	s.stop = make(chan nothing)
+	go a.runSlideshow(s.stop)
+	a.showSlideCaption()
+	if *verbose {
+		fmt.Printf("Slideshow started, delay %s\n", s.delay)
+	}
+}
+
+// pauseSlideshow pauses or resumes a running slideshow.
+func (a *Ptag) pauseSlideshow() {
+	s := a.slideshow
+	if s.stop != nil {
+		s.paused = !s.paused
+		a.setStatus(fmt.Sprintf("Slideshow paused: %v", s.paused))
+	}
+}
+
+// adjustDelay changes the slideshow delay by this amount.
+func (a *Ptag) adjustDelay(d time.Duration) {
+	s := a.slideshow
+	s.delay += d
+	if s.delay < time.Second {
+		s.delay = time.Second
+	}
+	a.setStatus(fmt.Sprintf("Slideshow delay: %s", s.delay))
+}
+
+// toggleLoop selects whether the slideshow restarts after the last image.
+func (a *Ptag) toggleLoop() {
+	a.slideshow.loop = !a.slideshow.loop
+	a.setStatus(fmt.Sprintf("Slideshow loop: %v", a.slideshow.loop))
+}
+
+// toggleShuffle selects whether the slideshow shows the images in random order.
+func (a *Ptag) toggleShuffle() {
+	s := a.slideshow
+	s.shuffle = !s.shuffle
+	if s.stop != nil {
+		s.makeOrder(a.index, len(a.picts))
+	}
+	a.setStatus(fmt.Sprintf("Slideshow shuffle: %v", s.shuffle))
+}
+
+// toggleSlideCaption shows or hides the caption overlay in the slideshow.
+func (a *Ptag) toggleSlideCaption() {
+	a.slideshow.caption = !a.slideshow.caption
+	a.showSlideCaption()
+}
+
+// setStatus displays a short message.
+func (a *Ptag) setStatus(msg string) {
+	if *verbose {
+		fmt.Printf("%s\n", msg)
+	}
+	a.win.SetTitle(fmt.Sprintf("%s - %s", a.picts[a.index].Title(), msg))
+}
+
+// showSlideCaption updates the caption overlay for the current image.
+func (a *Ptag) showSlideCaption() {
+	s := a.slideshow
+	capt, _ := a.picts[a.index].Field(a.captionField())
+	if s.stop == nil || !s.caption || len(capt) == 0 {
+		s.overlay.Hide()
+		return
+	}
+	s.text.Text = capt
+	s.overlay.Show()
+	s.overlay.Refresh()
+}
+
+// makeOrder creates the order that the images are shown,
+// starting at the current image.
+func (s *Slideshow) makeOrder(current, count int) {
+	s.order = s.order[:0]
+	s.pos = 0
+	if s.shuffle {
+		s.order = append(s.order, current)
+		for _, i := range rand.Perm(count) {
+			if i != current {
+				s.order = append(s.order, i)
+			}
+		}
+	} else {
+		for i := 0; i < count; i++ {
+			s.order = append(s.order, i)
+		}
+		s.pos = current
+	}
+}
+
+// next returns the index of the next image to show, or -1 if the
+// slideshow has finished.
+func (s *Slideshow) next(current, count int) int {
+	// The image list may have been changed e.g by a filter.
+	if len(s.order) != count {
+		s.makeOrder(current, count)
+	}
+	s.pos++
+	if s.pos >= len(s.order) {
+		if !s.loop {
+			return -1
+		}
+		if s.shuffle {
+			s.makeOrder(s.order[rand.Intn(len(s.order))], count)
+		} else {
+			s.pos = 0
+		}
+	}
+	return s.order[s.pos]
+}
+
+// peek returns the index of the image to be shown after the current one, or -1.
+func (s *Slideshow) peek() int {
+	if s.pos+1 < len(s.order) {
+		return s.order[s.pos+1]
+	}
+	return -1
+}
+
+// runSlideshow steps through the images until the slideshow is stopped.
+// The goroutine only provides the timing, and the images are changed
+// with the lock held.
+func (a *Ptag) runSlideshow(stop chan nothing) {
+	s := a.slideshow
+	for {
+		var delay time.Duration
+		a.locked(func() { delay = s.delay })
+		select {
+		case <-stop:
+			return
+		case <-time.After(delay):
+		}
+		running := true
+		var fade func()
+		a.locked(func() {
+			// The slideshow may have been stopped while waiting for the lock.
+			if s.stop != stop {
+				running = false
+				return
+			}
+			if s.paused {
+				return
+			}
+			index := s.next(a.index, len(a.picts))
+			if index < 0 {
+				a.toggleSlideshow()
+				running = false
+				return
+			}
+			fade = a.transition(index)
+			// Preload the image after this one, since in shuffle mode it
+			// won't be one of the neighbouring images.
+			if n := s.peek(); n >= 0 {
+				a.addCache(n)
+			}
+		})
+		if !running {
+			return
+		}
+		if fade != nil {
+			fade()
+		}
+	}
+}
+
+// transition displays the new image. If the image is to be faded in,
+// a function is returned that runs the fade. This is called without
+// the lock held, and the fade stops if the display is changed.
+func (a *Ptag) transition(index int) func() {
+	s := a.slideshow
+	dst, ok := a.iDraw.(*image.RGBA)
+	if s.fade <= 0 || !ok {
+		a.setIndex(index)
+		return nil
+	}
+	old := image.NewRGBA(dst.Bounds())
+	copy(old.Pix, dst.Pix)
+	a.setIndex(index)
+	if a.iDraw != draw.Image(dst) {
+		// Window has been resized.
+		return nil
+	}
+	img := image.NewRGBA(dst.Bounds())
+	copy(img.Pix, dst.Pix)
+	pause := s.fade / fadeSteps
+	return func() {
+		for step := 1; step <= fadeSteps; step++ {
+			changed := false
+			a.locked(func() {
+				if a.iDraw != draw.Image(dst) || a.index != index {
+					changed = true
+					return
+				}
+				if step == fadeSteps {
+					copy(dst.Pix, img.Pix)
+				} else {
+					mask := image.NewUniform(color.Alpha{uint8(step * 255 / fadeSteps)})
+					draw.Draw(dst, dst.Bounds(), old, image.Point{}, draw.Src)
+					draw.DrawMask(dst, dst.Bounds(), img, image.Point{}, mask, image.Point{}, draw.Over)
+				}
+				a.iCanvas.Refresh()
+			})
+			if changed || step == fadeSteps {
+				return
+			}
+			time.Sleep(pause)
+		}
+	}
+}
@@ -0,0 +1,186 @@
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+// Stacks of images such as bursts, where consecutive images were
+// captured within the stack gap of each other. A collapsed stack is
+// displayed as a single image (the cover), which is the highest rated
+// image in the stack, so that navigation moves between stacks.
+// An expanded stack displays all of its images.
+
+import (
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+)
+
+// buildStacks groups consecutive images whose capture times are within
+// the gap. Images without a capture time are not stacked.
+func buildStacks(picts []*Pict, times map[*Pict]time.Time, gap time.Duration) Stacks {
+	s := make(Stacks)
+	var st *Stack
+	for i, p := range picts {
+		t, ok := times[p]
+		if !ok {
+			st = nil
+			continue
+		}
+		if st != nil {
+			if d := t.Sub(times[picts[i-1]]); d <= gap && d >= -gap {
+				if len(st.picts) == 1 {
+					s[st.picts[0]] = st
+				}
+				st.picts = append(st.picts, p)
+				s[p] = st
+				continue
+			}
+		}
+		st = &Stack{picts: []*Pict{p}}
+	}
+	return s
+}
+
+// cover returns the highest rated image of the stack that is in the list.
+// The first image is used if the ratings are the same.
+func (st *Stack) cover(in map[*Pict]nothing) *Pict {
+	var best *Pict
+	bestRating := -2
+	for _, p := range st.picts {
+		if _, ok := in[p]; !ok {
+			continue
+		}
+		r, err := p.Rating()
+		if err != nil {
+			r = -1
+		}
+		if r > bestRating {
+			best, bestRating = p, r
+		}
+	}
+	return best
+}
+
+// view returns the images to be displayed, replacing each collapsed
+// stack with its cover.
+func (s Stacks) view(picts []*Pict) []*Pict {
+	in := make(map[*Pict]nothing)
+	for _, p := range picts {
+		in[p] = nothing{}
+	}
+	done := make(map[*Stack]bool)
+	var v []*Pict
+	for _, p := range picts {
+		st, ok := s[p]
+		if !ok || st.expanded {
+			v = append(v, p)
+		} else if !done[st] {
+			done[st] = true
+			v = append(v, st.cover(in))
+		}
+	}
+	return v
+}
+
+// same returns true if both images are in the same stack.
+func (s Stacks) same(p1, p2 *Pict) bool {
+	st, ok := s[p1]
+	return ok && st == s[p2]
+}
+
+// label describes the stack of the image for the window title.
+func (s Stacks) label(p *Pict) string {
+	st, ok := s[p]
+	if !ok {
+		return ""
+	}
+	if !st.expanded {
+		return fmt.Sprintf(" [stack of %d]", len(st.picts))
+	}
+	for i, sp := range st.picts {
+		if sp == p {
+			return fmt.Sprintf(" [stack %d/%d]", i+1, len(st.picts))
+		}
+	}
+	return ""
+}
+
+// stacked returns the images that match the filter, with the stacks applied.
+func (a *Ptag) stacked() []*Pict {
+	var picts []*Pict
+	for _, p := range a.all {
+		if a.filter == nil || a.filter.match(p) {
+			picts = append(picts, p)
+		}
+	}
+	return a.stacks.view(picts)
+}
+
+// toggleStacks turns stacking on or off. The capture times are read in
+// the background before the stacks are displayed.
+func (a *Ptag) toggleStacks() {
+	if a.review != nil {
+		a.setStatus("Stacks are off while reviewing duplicates")
+		return
+	}
+	if a.stacks != nil {
+		a.stacks = nil
+		a.applyFilter(a.filter)
+		a.setStatus("Stacks off")
+		return
+	}
+	var lock sync.Mutex
+	times := make(map[*Pict]time.Time)
+	a.runBatch("Stacking", a.all, false, func(p *Pict) error {
+		t, err := captureTime(p)
+		if err != nil {
+			// Images without a capture time are not stacked.
+			return nil
+		}
+		lock.Lock()
+		times[p] = t
+		lock.Unlock()
+		return nil
+	}, func() {
+		a.stacks = buildStacks(a.all, times, *stackGap)
+		a.applyFilter(a.filter)
+		n := make(map[*Stack]nothing)
+		for _, st := range a.stacks {
+			n[st] = nothing{}
+		}
+		a.setStatus(fmt.Sprintf("%d stacks", len(n)))
+	})
+}
+
+// restack updates the displayed images after ratings have changed,
+// since the cover of a stack is its highest rated image.
+// The images are not changed in compare mode.
+func (a *Ptag) restack() {
+	if a.stacks == nil || a.compare != nil {
+		return
+	}
+	if !slices.Equal(a.stacked(), a.picts) {
+		a.applyFilter(a.filter)
+	}
+}
+
+// expandStack expands or collapses the stack holding the current image.
+func (a *Ptag) expandStack() {
+	st, ok := a.stacks[a.picts[a.index]]
+	if !ok {
+		a.setStatus("Not in a stack")
+		return
+	}
+	st.expanded = !st.expanded
+	a.applyFilter(a.filter)
+}
@@ -0,0 +1,281 @@
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+// Syncing and migrating metadata between the stores: the metadata
+// embedded in the image, the .exif sidecar, and an XMP sidecar.
+// A field that is set in only one store is copied to the other, and
+// a conflict (a field with different values) is resolved by a policy:
+//
+//	newer     The value from the most recently modified file.
+//	embedded  The value from the embedded metadata (or the first store).
+//	merge     Lists such as keywords are combined, and other fields
+//	          use the newer value.
+//	mirror    The most recently modified file replaces the other, so a
+//	          field missing from it is deleted from the other store.
+//
+// Except when mirroring, a field that was deleted from one store is
+// restored from the other, since a missing field is copied.
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// The names of the metadata stores.
+var storeNames = []string{"embedded", "sidecar", "xmp"}
+
+// openStore reads the metadata of the image from the store.
+func openStore(name, file string) (*metaStore, error) {
+	s := &metaStore{name: name}
+	var err error
+	switch name {
+	case "embedded":
+		s.file = file
+		s.exif, err = newExivEmbedded(file, nil)
+	case "sidecar":
+		s.file = file + ".exif"
+		s.exif, err = newExivSidecar(file, nil)
+	case "xmp":
+		s.file = xmpPath(file)
+		s.exif, err = newExivXmp(file, nil)
+	default:
+		return nil, fmt.Errorf("unknown metadata store (%s)", name)
+	}
+	if err != nil {
+		return nil, err
+	}
+	s.fields = s.exif.Fields()
+	if name == "embedded" {
+		// The shooting information that can be changed (the dates)
+		// is only read from the image when required.
+		info := readInfo(file)
+		for f := range infoFields {
+			if _, ok := exivToSet[f]; ok && len(info[f]) != 0 {
+				s.fields[f] = info[f]
+			}
+		}
+	}
+	if st, err := os.Stat(s.file); err == nil {
+		s.mtime = st.ModTime()
+	}
+	return s, nil
+}
+
+// storable returns true if the field can be written to the store.
+// An XMP sidecar only holds fields that have XMP tags.
+func (s *metaStore) storable(field int) bool {
+	if s.name != "xmp" {
+		return true
+	}
+	tags, _, _ := writeTags(field)
+	for _, t := range tags {
+		if strings.HasPrefix(t, "Xmp.") {
+			return true
+		}
+	}
+	return false
+}
+
+// isList returns true if the field is a list, such as the keywords.
+func isList(field int) bool {
+	tags, _, _ := writeTags(field)
+	for _, t := range tags {
+		if _, ok := bagTags[t]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// fieldName returns the name of the field for reports.
+func fieldName(field int) string {
+	exiv, lang := splitField(field)
+	for n, f := range fieldNames {
+		if f == exiv {
+			if lang != defaultLang {
+				return n + "-" + lang
+			}
+			return n
+		}
+	}
+	if tags, _, ok := writeTags(field); ok && len(tags) != 0 {
+		return tags[0]
+	}
+	return fmt.Sprintf("field %d", field)
+}
+
+// resolve returns the value to use when the stores have different values.
+func resolve(field int, a, b *metaStore, policy string) string {
+	va, vb := a.fields[field], b.fields[field]
+	newer, older := va, vb
+	if b.mtime.After(a.mtime) {
+		newer, older = vb, va
+	}
+	switch policy {
+	case "embedded":
+		if b.name == "embedded" {
+			return vb
+		}
+		return va
+	case "merge":
+		if isList(field) {
+			l := splitList(newer)
+			for _, item := range splitList(older) {
+				if !contains(l, item) {
+					l = append(l, item)
+				}
+			}
+			return joinList(l)
+		}
+	}
+	return newer
+}
+
+// deleted returns true if the field set in the other store is to be deleted
+// because it is missing from the store. This is only done when mirroring the
+// newer store, and only for fields that the store can hold. The shooting
+// information is never deleted.
+func (s *metaStore) deleted(field int, other *metaStore, policy string) bool {
+	if _, ok := infoFields[field]; ok || policy != "mirror" {
+		return false
+	}
+	return s.mtime.After(other.mtime) && s.storable(field)
+}
+
+// syncStores returns the changes that make the stores the same.
+// A change to an empty value deletes the field.
+func syncStores(a, b *metaStore, policy string) []syncChange {
+	var fields []int
+	for f := range a.fields {
+		fields = append(fields, f)
+	}
+	for f := range b.fields {
+		if _, ok := a.fields[f]; !ok {
+			fields = append(fields, f)
+		}
+	}
+	sort.Ints(fields)
+	var changes []syncChange
+	for _, f := range fields {
+		va, okA := a.fields[f]
+		vb, okB := b.fields[f]
+		var v string
+		switch {
+		case okA && okB && va == vb:
+			continue
+		case !okB && b.deleted(f, a, policy):
+			changes = append(changes, syncChange{a, f, va, ""})
+			continue
+		case !okA && a.deleted(f, b, policy):
+			changes = append(changes, syncChange{b, f, vb, ""})
+			continue
+		case !okB:
+			v = va
+		case !okA:
+			v = vb
+		default:
+			v = resolve(f, a, b, policy)
+		}
+		for _, s := range []*metaStore{a, b} {
+			if old, ok := s.fields[f]; (!ok || old != v) && s.storable(f) {
+				changes = append(changes, syncChange{s, f, old, v})
+			}
+		}
+	}
+	return changes
+}
+
+// syncImage syncs the metadata of the image between the stores, reporting
+// the changes. If to is set, only that store is changed. The number of
+// changes and the number that failed are returned.
+func syncImage(file string, names []string, policy, to string, dryRun bool) (int, int, error) {
+	a, err := openStore(names[0], file)
+	if err != nil {
+		return 0, 0, err
+	}
+	b, err := openStore(names[1], file)
+	if err != nil {
+		return 0, 0, err
+	}
+	n, failed := 0, 0
+	for _, c := range syncStores(a, b, policy) {
+		if len(to) != 0 && c.store.name != to {
+			continue
+		}
+		n++
+		fmt.Printf("%s: %s %s %q -> %q\n", file, c.store.name, fieldName(c.field), c.old, c.new)
+		if dryRun {
+			continue
+		}
+		var err error
+		if len(c.new) == 0 {
+			err = c.store.exif.Delete(c.field)
+		} else {
+			err = c.store.exif.Set(c.field, c.new)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %s: %v\n", file, c.store.name, err)
+			failed++
+		}
+	}
+	return n, failed, nil
+}
+
+// syncCmd syncs the metadata of the images on the command line
+// between two stores, or migrates it from one store to the other.
+func syncCmd(args []string) error {
+	fs := flag.NewFlagSet("sync", flag.ExitOnError)
+	stores := fs.String("stores", "embedded,sidecar", "The two metadata stores (embedded, sidecar or xmp)")
+	policy := fs.String("policy", "newer", "Conflict policy (newer, embedded, merge or mirror)")
+	to := fs.String("to", "", "Only change this store (i.e migrate to it)")
+	dryRun := fs.Bool("n", false, "Report the changes without making them")
+	fs.Parse(args)
+	names := strings.Split(*stores, ",")
+	if len(names) != 2 || names[0] == names[1] || !contains(storeNames, names[0]) || !contains(storeNames, names[1]) {
+		return fmt.Errorf("-stores must be two of %s", strings.Join(storeNames, ", "))
+	}
+	if len(*to) != 0 && !contains(names, *to) {
+		return fmt.Errorf("-to must be one of the stores (%s)", *stores)
+	}
+	switch *policy {
+	case "newer", "embedded", "merge", "mirror":
+	default:
+		return fmt.Errorf("unknown policy (%s)", *policy)
+	}
+	files := expand(fs.Args())
+	if len(files) == 0 {
+		return fmt.Errorf("no images")
+	}
+	changed, total, failed := 0, 0, 0
+	for _, file := range files {
+		n, f, err := syncImage(file, names, *policy, *to, *dryRun)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", file, err)
+			failed++
+		}
+		if n != 0 {
+			changed++
+			total += n
+		}
+		failed += f
+	}
+	fmt.Printf("%d of %d images, %d changes\n", changed, len(files), total)
+	if failed != 0 {
+		return fmt.Errorf("%d images or changes failed", failed)
+	}
+	return nil
+}
@@ -0,0 +1,118 @@
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testStore returns a store holding the fields, modified at the time.
+func testStore(name string, mtime time.Time, fields map[int]string) *metaStore {
+	return &metaStore{name: name, fields: fields, mtime: mtime}
+}
+
+func TestResolve(t *testing.T) {
+	old := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	newer := old.Add(time.Hour)
+	tests := []struct {
+		name   string
+		policy string
+		field  int
+		a, b   string // Names of the stores
+		aNewer bool
+		va, vb string
+		want   string
+	}{
+		{"newer first", "newer", EXIV_HEADLINE, "embedded", "sidecar", true, "one", "two", "one"},
+		{"newer second", "newer", EXIV_HEADLINE, "embedded", "sidecar", false, "one", "two", "two"},
+		{"embedded first", "embedded", EXIV_HEADLINE, "embedded", "sidecar", false, "one", "two", "one"},
+		{"embedded second", "embedded", EXIV_HEADLINE, "sidecar", "embedded", true, "one", "two", "two"},
+		{"embedded neither", "embedded", EXIV_HEADLINE, "sidecar", "xmp", false, "one", "two", "one"},
+		{"merge list", "merge", EXIV_KEYWORDS, "embedded", "sidecar", false, "a, b", "b, c", "b, c, a"},
+		{"merge list newer first", "merge", EXIV_KEYWORDS, "embedded", "sidecar", true, "a, b", "b, c", "a, b, c"},
+		{"merge text", "merge", EXIV_HEADLINE, "embedded", "sidecar", false, "one", "two", "two"},
+		{"mirror", "mirror", EXIV_HEADLINE, "embedded", "sidecar", true, "one", "two", "one"},
+	}
+	for _, tc := range tests {
+		ta, tb := old, newer
+		if tc.aNewer {
+			ta, tb = newer, old
+		}
+		a := testStore(tc.a, ta, map[int]string{tc.field: tc.va})
+		b := testStore(tc.b, tb, map[int]string{tc.field: tc.vb})
+		if got := resolve(tc.field, a, b, tc.policy); got != tc.want {
+			t.Errorf("%s: got %q, want %q", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestSyncStores(t *testing.T) {
+	old := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	newer := old.Add(time.Hour)
+	tests := []struct {
+		name   string
+		policy string
+		a, b   string // Names of the stores
+		aNewer bool
+		fa, fb map[int]string
+		want   []string // Changes as store:field:old:new
+	}{
+		{"same", "newer", "embedded", "sidecar", true,
+			map[int]string{EXIV_RATING: "3"}, map[int]string{EXIV_RATING: "3"}, nil},
+		{"only first", "newer", "embedded", "sidecar", false,
+			map[int]string{EXIV_RATING: "3"}, map[int]string{}, []string{"sidecar:rating::3"}},
+		{"only second", "newer", "embedded", "sidecar", true,
+			map[int]string{}, map[int]string{EXIV_HEADLINE: "Beach"}, []string{"embedded:headline::Beach"}},
+		{"conflict newer", "newer", "embedded", "sidecar", false,
+			map[int]string{EXIV_RATING: "3"}, map[int]string{EXIV_RATING: "5"}, []string{"embedded:rating:3:5"}},
+		{"conflict embedded", "embedded", "sidecar", "embedded", true,
+			map[int]string{EXIV_RATING: "3"}, map[int]string{EXIV_RATING: "5"}, []string{"sidecar:rating:3:5"}},
+		{"conflict merge", "merge", "embedded", "sidecar", true,
+			map[int]string{EXIV_KEYWORDS: "a"}, map[int]string{EXIV_KEYWORDS: "b"},
+			[]string{"embedded:keywords:a:a, b", "sidecar:keywords:b:a, b"}},
+		{"conflict mirror", "mirror", "embedded", "sidecar", true,
+			map[int]string{EXIV_RATING: "3"}, map[int]string{EXIV_RATING: "5"}, []string{"sidecar:rating:5:3"}},
+		{"xmp cannot store", "newer", "embedded", "xmp", false,
+			map[int]string{EXIV_ORIENTATION: "6", EXIV_RATING: "2"}, map[int]string{}, []string{"xmp:rating::2"}},
+		{"xmp conflict", "newer", "embedded", "xmp", false,
+			map[int]string{EXIV_ORIENTATION: "6", EXIV_RATING: "2"}, map[int]string{EXIV_RATING: "4"}, []string{"embedded:rating:2:4"}},
+		{"copy not deleted", "newer", "embedded", "sidecar", false,
+			map[int]string{EXIV_HEADLINE: "Beach"}, map[int]string{}, []string{"sidecar:headline::Beach"}},
+		{"mirror deletes", "mirror", "embedded", "sidecar", false,
+			map[int]string{EXIV_HEADLINE: "Beach"}, map[int]string{}, []string{"embedded:headline:Beach:"}},
+		{"mirror copies from newer", "mirror", "embedded", "sidecar", true,
+			map[int]string{EXIV_HEADLINE: "Beach"}, map[int]string{}, []string{"sidecar:headline::Beach"}},
+		{"mirror xmp cannot store", "mirror", "embedded", "xmp", false,
+			map[int]string{EXIV_ORIENTATION: "6", EXIV_RATING: "2"}, map[int]string{}, []string{"embedded:rating:2:"}},
+		{"mirror keeps dates", "mirror", "embedded", "sidecar", false,
+			map[int]string{EXIV_DATE: "2024:01:01 10:00:00"}, map[int]string{}, []string{"sidecar:Exif.Photo.DateTimeOriginal::2024:01:01 10:00:00"}},
+	}
+	for _, tc := range tests {
+		ta, tb := old, newer
+		if tc.aNewer {
+			ta, tb = newer, old
+		}
+		a := testStore(tc.a, ta, tc.fa)
+		b := testStore(tc.b, tb, tc.fb)
+		var got []string
+		for _, c := range syncStores(a, b, tc.policy) {
+			got = append(got, fmt.Sprintf("%s:%s:%s:%s", c.store.name, fieldName(c.field), c.old, c.new))
+		}
+		if strings.Join(got, "|") != strings.Join(tc.want, "|") {
+			t.Errorf("%s: got %q, want %q", tc.name, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,155 @@
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+// Copying captions between images, and caption templates.
+// A template is a caption containing variables that are expanded
+// from the image's metadata when the template is applied:
+//
+//	{date}     Capture date (YYYY-MM-DD), or the file modification date
+//	{time}     Capture time (HH:MM)
+//	{filename} File name
+//	{name}     File name without the extension
+//	{seq}      Position of the image in the displayed or marked images
+//	{camera}   Camera make and model
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Caption templates read from the templates file.
+var templates []string
+
+// readTemplates reads a file of caption templates, one per line.
+// Blank lines and lines starting with '#' are ignored.
+func readTemplates(file string) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		t := strings.TrimSpace(scanner.Text())
+		if len(t) == 0 || strings.HasPrefix(t, "#") {
+			continue
+		}
+		templates = append(templates, t)
+	}
+	return scanner.Err()
+}
+
+// expandTemplate replaces the variables in the template with the values from the image.
+// Unknown variables are left unchanged.
+func expandTemplate(t string, p *Pict, seq int) string {
+	if !strings.Contains(t, "{") {
+		return t
+	}
+	info, err := p.Info()
+	if err != nil {
+		info = map[int]string{}
+	}
+	captured, _ := p.Date(EXIV_DATE)
+	d, err := parseExifTime(captured)
+	if err != nil {
+		d = time.Time{}
+		if st, err := os.Stat(p.Path()); err == nil {
+			d = st.ModTime()
+		}
+	}
+	var date, tm string
+	if !d.IsZero() {
+		date = d.Format("2006-01-02")
+		tm = d.Format("15:04")
+	}
+	r := strings.NewReplacer(
+		"{date}", date,
+		"{time}", tm,
+		"{filename}", p.Name(),
+		"{name}", strings.TrimSuffix(p.Name(), filepath.Ext(p.Name())),
+		"{seq}", strconv.Itoa(seq),
+		"{camera}", cameraName(info),
+	)
+	return strings.TrimSpace(r.Replace(t))
+}
+
+// setCaption sets the caption on the current image and updates the caption entry.
+func (a *Ptag) setCaption(caption string) {
+	p := a.picts[a.index]
+	if err := p.SetField(a.captionField(), caption); err != nil {
+		a.setStatus(fmt.Sprintf("Failed to set caption: %v", err))
+		return
+	}
+	a.caption.SetText(caption)
+	a.completer.addCaption(caption)
+}
+
+// previousCaption copies the caption from the previous image to the current image.
+func (a *Ptag) previousCaption() {
+	if a.index == 0 {
+		a.setStatus("No previous image")
+		return
+	}
+	a.Sync()
+	c, err := a.picts[a.index-1].Field(a.captionField())
+	if err != nil {
+		a.setStatus(fmt.Sprintf("Failed to read caption: %v", err))
+		return
+	}
+	a.setCaption(c)
+}
+
+// copyCaption copies the caption of the current image to the clipboard.
+func (a *Ptag) copyCaption() {
+	a.Sync()
+	a.win.Clipboard().SetContent(a.caption.Text)
+	a.setStatus("Caption copied")
+}
+
+// pasteCaption sets the caption of the current image from the clipboard.
+func (a *Ptag) pasteCaption() {
+	a.setCaption(strings.TrimSpace(a.win.Clipboard().Content()))
+}
+
+// applyTemplate expands the template and sets it as the caption of the current image.
+func (a *Ptag) applyTemplate(t string) {
+	a.setCaption(expandTemplate(t, a.picts[a.index], a.index+1))
+}
+
+// batchTemplate expands the template for each of the marked images and sets the caption.
+func (a *Ptag) batchTemplate(name, t string) {
+	seq := map[*Pict]int{}
+	for i, p := range a.marked() {
+		seq[p] = i + 1
+	}
+	field := a.captionField()
+	a.batch(name, false, func(p *Pict) error {
+		return p.SetField(field, expandTemplate(t, p, seq[p]))
+	})
+}
+
+// batchApplyCaption sets the caption of the current image on the marked images.
+func (a *Ptag) batchApplyCaption() {
+	a.Sync()
+	c := a.caption.Text
+	field := a.captionField()
+	a.batch("Apply caption", false, func(p *Pict) error {
+		return p.SetField(field, c)
+	})
+}
@@ -16,31 +16,282 @@ import (
 	"image"
 	"image/draw"
 	"sync"
+	"time"
 
 	"fyne.io/fyne/v2"
 	"fyne.io/fyne/v2/canvas"
 	"fyne.io/fyne/v2/widget"
+	"golang.org/x/image/font"
 )
 
 type nothing struct{}
 
+// action is a command that can be bound to shortcut keys
+// and run from the command palette.
+type action struct {
+	id   string         // Identifier used in the key map file
+	name string         // Description
+	keys []fyne.KeyName // Shortcut keys
+	run  func(*Ptag)    // Run the action
+}
+
+// filter selects the images to be displayed.
+type filter struct {
+	name  string           // Description
+	match func(*Pict) bool // Returns true if the image is selected
+}
+
 type CaptionEntry struct {
 	app     *Ptag
 	mouseIn bool
+	editing bool // Caption has the focus
 	widget.Entry
 }
 
+// PaletteEntry is the search entry of the command palette.
+type PaletteEntry struct {
+	palette *Palette
+	skip    fyne.KeyName // Key whose typed character should be ignored
+	widget.Entry
+}
+
+// Palette is a popup that allows actions and files to be searched for and selected.
+type Palette struct {
+	app      *Ptag
+	popup    *widget.PopUp
+	entry    *PaletteEntry
+	list     *widget.List
+	items    []paletteItem // All the items
+	matched  []paletteItem // Items matching the search text
+	selected int           // Selected item in matched list
+}
+
+type paletteItem struct {
+	name string
+	run  func()
+}
+
+// Slideshow holds the slideshow settings and state.
+type Slideshow struct {
+	delay   time.Duration   // Delay between images
+	fade    time.Duration   // Cross-fade time, 0 for none
+	loop    bool            // Restart after the last image
+	shuffle bool            // Show images in random order
+	caption bool            // Show the caption overlay
+	paused  bool            // Slideshow is paused
+	order   []int           // Order that images are shown
+	pos     int             // Current position in order
+	stop    chan nothing    // Closed to stop the slideshow, nil if not running
+	text    *canvas.Text    // Caption text
+	overlay *fyne.Container // Caption overlay
+}
+
+// Compare holds the state of compare mode.
+type Compare struct {
+	n      int             // Number of panels
+	panels []int           // Image index in each panel, the first is the pick
+	active int             // Active panel
+	labels []*canvas.Text  // Name and rating of each panel
+	grid   *fyne.Container // Container holding the labels
+}
+
+// InfoOverlay displays the shooting information of the current image.
+type InfoOverlay struct {
+	lines *fyne.Container // Lines of information
+	box   *fyne.Container // Overlay containing the lines
+}
+
+// HistogramOverlay displays the histogram of the current image.
+type HistogramOverlay struct {
+	img  *canvas.Image   // Rendered histogram
+	text *canvas.Text    // Clipping summary
+	box  *fyne.Container // Overlay container
+	stop chan nothing    // Closed to stop blinking clipping indicators, nil if not running
+}
+
+// moved records a file that has been moved or copied.
+type moved struct {
+	from, to string
+}
+
+// undoItem is an action that can be undone.
+type undoItem struct {
+	name string       // Description of the action
+	undo func() error // Reverses the action
+}
+
+// Progress displays the progress of a background batch operation.
+type Progress struct {
+	label   *canvas.Text        // Name of operation
+	bar     *widget.ProgressBar // Progress bar
+	box     *fyne.Container     // Overlay container
+	running bool                // A batch operation is running, protected by the Ptag lock
+}
+
+// Completer suggests completions for the caption being typed.
+type Completer struct {
+	lock     sync.Mutex      // Protects terms
+	terms    map[string]int  // Known terms and how often they have been seen
+	matched  []completion    // Current suggestions
+	selected int             // Selected suggestion
+	quiet    bool            // Ignore caption changes
+	items    *fyne.Container // Suggestion buttons
+	box      *fyne.Container // Overlay container
+}
+
+// completion is a suggested term, replacing the caption text from start.
+type completion struct {
+	term  string
+	start int
+}
+
+// trackPoint is a position recorded in a GPX track.
+type trackPoint struct {
+	time     time.Time
+	lat, lon float64 // Degrees, negative for south and west
+	ele      float64 // Elevation in metres
+	hasEle   bool    // Elevation is known
+}
+
+// geoMatch is the position matched to an image from a GPX track.
+type geoMatch struct {
+	p      *Pict
+	camera time.Time     // Capture time from the camera, zero if unknown
+	pos    trackPoint    // Matched position
+	delta  time.Duration // Time from the nearest track point
+	ok     bool          // Position is within the maximum gap
+}
+
+// place is a populated place from the GeoNames gazetteer.
+type place struct {
+	name, state, country string
+	lat, lon             float64
+}
+
+// Stack is a group of consecutive images taken within the stack gap of each other.
+type Stack struct {
+	picts    []*Pict
+	expanded bool // All the images are displayed, not just the cover
+}
+
+// Stacks maps each stacked image to its stack.
+type Stacks map[*Pict]*Stack
+
+// dupGroup is a group of duplicate images.
+type dupGroup struct {
+	picts []*Pict
+	exact bool // All the files are identical
+}
+
+// Review holds the state of the duplicate review mode.
+type Review struct {
+	groups []dupGroup
+	group  int     // Group being reviewed
+	keep   *Pict   // Image kept from the group being reviewed
+	filter *filter // Filter to restore when the review finishes
+	stacks Stacks  // Stacks to restore when the review finishes
+}
+
+// Options for exporting resized JPEGs.
+type exportOptions struct {
+	dir     string // Relative to the image directory if not absolute
+	name    string // File name template, without the extension
+	size    int    // Maximum width or height, 0 for the original size
+	quality int
+	strip   bool // Remove the metadata
+}
+
+// An image in a gallery. The fields are used by the page template.
+type galleryItem struct {
+	Image   string // Path of the image, relative to the gallery
+	Thumb   string // Path of the thumbnail, relative to the gallery
+	Name    string
+	Caption string
+	Rating  int
+	seq     int
+}
+
+// An image on a contact sheet.
+type sheetEntry struct {
+	img     image.Image
+	name    string
+	rating  int
+	caption string
+}
+
+// A change to a field of an image, imported from a metadata file.
+type metaChange struct {
+	p        *Pict
+	column   string
+	tag      int
+	old, new string
+}
+
+// A store of metadata being synced.
+type metaStore struct {
+	name   string // embedded, sidecar or xmp
+	file   string // File holding the metadata
+	exif   Exif
+	fields map[int]string
+	mtime  time.Time // Modification time of the file, zero if none
+}
+
+// A change to a field of a metadata store, made when syncing.
+type syncChange struct {
+	store    *metaStore
+	field    int
+	old, new string
+}
+
+// Layout of a contact sheet, in pixels.
+type sheetLayout struct {
+	width, height int // Page size
+	cols, rows    int // Images per page
+	margin        int
+	cellW, cellH  int
+	imgW, imgH    int // Maximum image size
+	lineH         int
+	face          font.Face
+}
+
 // The list of EXIF fields that we care about
 const (
 	EXIV_RATING = iota
 	EXIV_HEADLINE
 	EXIV_ORIENTATION
+	EXIV_LABEL
+	EXIV_TITLE
+	EXIV_DESCRIPTION
+	EXIV_KEYWORDS
+	EXIV_SUBJECT
+	// GPS position
+	EXIV_GPS_LATITUDE
+	EXIV_GPS_LATITUDE_REF
+	EXIV_GPS_LONGITUDE
+	EXIV_GPS_LONGITUDE_REF
+	EXIV_GPS_ALTITUDE
+	EXIV_GPS_ALTITUDE_REF
+	// Location
+	EXIV_CITY
+	EXIV_STATE
+	EXIV_COUNTRY
+	// Read-only shooting information
+	EXIV_MAKE
+	EXIV_MODEL
+	EXIV_LENS
+	EXIV_FOCAL_LENGTH
+	EXIV_FNUMBER
+	EXIV_EXPOSURE
+	EXIV_ISO
+	EXIV_DATE
+	EXIV_CREATE_DATE
 )
 
 type Exif interface {
 	Get(int) (string, bool)
 	Set(int, string) error
 	Delete(int) error
+	Fields() map[int]string // Copy of all the fields that are set
 }
 
 // Cached image data.
@@ -48,34 +299,76 @@ type Data struct {
 	location image.Rectangle   // Location and size of displayed image
 	cleared  []image.Rectangle // Margins to be cleared
 	img      image.Image       // Image to be displayed
+	hist     *Histogram        // Histogram of displayed image
+}
+
+// Histogram and clipping masks of an image.
+type Histogram struct {
+	lum, red, green, blue [256]int     // Counts of each value
+	highlights            *image.Alpha // Mask of highlight clipped pixels
+	shadows               *image.Alpha // Mask of shadow clipped pixels
+	highCount, lowCount   int          // Number of clipped pixels
 }
 
 // Pict represents one image.
 type Pict struct {
-	state int            // Current state
-	path  string         // Filename of picture
-	name  string         // short name
-	title string         // window title
-	index int            // Index within list of images
-	err   error          // Error during loading
-	lock  sync.WaitGroup // lock for loading
-	exif  Exif           // Exif object
-	data  *Data          // Cached mage data, nil if unloaded
+	state    int            // Current state
+	path     string         // Filename of picture
+	name     string         // short name
+	title    string         // window title
+	index    int            // Index within list of displayed images
+	seq      int            // Sequence number within all images
+	err      error          // Error during loading
+	loadLock sync.Mutex     // lock for state, err, size, data and loading
+	loading  chan nothing   // Closed when loading completes, nil if not loading
+	exifLock sync.Mutex     // lock for reading EXIF
+	exif     Exif           // Exif object
+	marked   bool           // Marked for batch operations
+	info     map[int]string // Shooting information, nil if not read
+	size     image.Point    // Size of original image
+	data     *Data          // Cached mage data, nil if unloaded
+	hashLock sync.Mutex     // lock for the hashes
+	hashed   bool           // Hashes have been calculated
+	hash     uint64         // Perceptual hash of the image
+	sum      [32]byte       // SHA-256 of the file
 }
 
 // Main Ptag object. Holds the state of the application.
 type Ptag struct {
-	app     fyne.App          // Main application
-	win     fyne.Window       // Main window
-	rating  *canvas.Text      // widget holding rating stars
-	caption *CaptionEntry     // Caption entry widget
-	top     *fyne.Container   // top box containing stars and caption elements
-	iDraw   draw.Image        // Image backing the canvas being displayed
-	iCanvas fyne.CanvasObject // Canvas holding the displayed image
-	picts   []*Pict           // List of images
-	index   int               // Current picture index
-	preload int               // Number of images to preload
-	loaded  map[int]nothing   // Set of images that are cached
-	active  bool              // True if window now active
-	updated bool              // Set if the EXIF data may have changed
+	app        fyne.App                 // Main application
+	win        fyne.Window              // Main window
+	rating     *canvas.Text             // widget holding rating stars
+	caption    *CaptionEntry            // Caption entry widget
+	top        *fyne.Container          // top box containing stars and caption elements
+	iDraw      draw.Image               // Image backing the canvas being displayed
+	iCanvas    fyne.CanvasObject        // Canvas holding the displayed image
+	picts      []*Pict                  // List of displayed images
+	all        []*Pict                  // List of all images
+	filter     *filter                  // Filter selecting displayed images, nil for all
+	index      int                      // Current picture index
+	preload    int                      // Number of images to preload
+	loaded     map[int]nothing          // Set of images that are cached
+	active     bool                     // True if window now active
+	updated    bool                     // Set if the EXIF data may have changed
+	keys       map[fyne.KeyName]*action // Key bindings
+	lastKey    fyne.KeyName             // Last key pressed
+	help       *widget.PopUp            // Help overlay
+	palette    *Palette                 // Command palette
+	overlay    *fyne.Container          // Items displayed over the image
+	slideshow  *Slideshow               // Slideshow settings
+	compare    *Compare                 // Compare mode, nil if not active
+	info       *InfoOverlay             // Shooting information overlay
+	histo      *HistogramOverlay        // Histogram overlay
+	undoList   []undoItem               // Actions that can be undone
+	marks      *canvas.Text             // Count of marked images
+	anchor     *Pict                    // Start of a range of marked images
+	progress   *Progress                // Batch progress
+	completer  *Completer               // Caption completion
+	dirty      *canvas.Text             // Shows that the caption has not been written
+	lang       string                   // Language being edited
+	langSelect *widget.Select           // Language selector
+	track      []trackPoint             // GPX track used for geotagging
+	review     *Review                  // Duplicate review, nil if not active
+	stacks     Stacks                   // Stacks of images, nil if not stacked
+	lock       sync.Mutex               // Serialises changes to the display state
 }